@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// ackTracker follows events from the moment they leave the parser until
+// Honeycomb acknowledges them, to work out how far into each file it's safe to
+// record in the statefile with --tail.commit_on_ack.
+//
+// Events have to be tracked in the order they come out of the parser, which
+// has to be the same order as the lines went in. An event's offset can then be
+// committed once it and every event tracked before it from the same file are
+// done. Lines that didn't produce an event are covered by the next event that
+// gets done.
+type ackTracker struct {
+	lock  sync.Mutex
+	files map[string]*ackWindow
+}
+
+// ackWindow holds the events from one file that aren't done yet
+type ackWindow struct {
+	// offsets of the events that aren't done, in the order they were tracked
+	pending []int64
+	// outstanding counts the events at each pending offset that aren't done
+	outstanding map[int64]int
+	// committed is the furthest offset that's safe to save
+	committed int64
+	// dirty is set when committed hasn't been saved yet
+	dirty bool
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{
+		files: make(map[string]*ackWindow),
+	}
+}
+
+// trackEvents tracks every event read from events, in order, and passes them
+// along on the returned channel, which is closed when events is closed
+func (a *ackTracker) trackEvents(events chan event.Event) chan event.Event {
+	tracked := make(chan event.Event, cap(events))
+	go func() {
+		defer close(tracked)
+		for ev := range events {
+			a.track(ev)
+			tracked <- ev
+		}
+	}()
+	return tracked
+}
+
+// track records an event that's on its way to Honeycomb
+func (a *ackTracker) track(ev event.Event) {
+	if ev.Source == "" {
+		// STDIN has nowhere to save its position
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	w, ok := a.files[ev.Source]
+	if !ok {
+		w = &ackWindow{outstanding: make(map[int64]int)}
+		a.files[ev.Source] = w
+	}
+	if n := len(w.pending); n == 0 || w.pending[n-1] != ev.Offset {
+		w.pending = append(w.pending, ev.Offset)
+	}
+	w.outstanding[ev.Offset]++
+}
+
+// done records that an event was acknowledged, or that it was dropped on
+// purpose and won't ever be sent
+func (a *ackTracker) done(ev event.Event) {
+	if a == nil || ev.Source == "" {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	w, ok := a.files[ev.Source]
+	if !ok || w.outstanding[ev.Offset] == 0 {
+		return
+	}
+	w.outstanding[ev.Offset]--
+	// move committed forward past everything that's done
+	for len(w.pending) > 0 && w.outstanding[w.pending[0]] == 0 {
+		delete(w.outstanding, w.pending[0])
+		w.committed = w.pending[0]
+		w.dirty = true
+		w.pending = w.pending[1:]
+	}
+}
+
+// commit saves the committed offset of each file to its statefile
+func (a *ackTracker) commit() {
+	if a == nil {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for file, w := range a.files {
+		if w.dirty {
+			if err := tail.CommitOffset(file, w.committed); err != nil {
+				logrus.WithError(err).WithField("file", file).
+					Warn("Failed to save acknowledged position to statefile")
+				continue
+			}
+			w.dirty = false
+		}
+		// once a file that's been closed has all its events done, there's
+		// nothing left to save for it
+		if len(w.pending) == 0 && tail.ForgetClosedFile(file, w.committed) {
+			delete(a.files, file)
+		}
+	}
+}
+
+// commitEvery saves the committed offsets once per interval until done is
+// closed, then saves them one last time
+func (a *ackTracker) commitEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.commit()
+		case <-done:
+			a.commit()
+			return
+		}
+	}
+}
@@ -4,6 +4,25 @@ package event
 
 import "time"
 
+// Line is a single line read from a log, passed from the tailer to parsers
+type Line struct {
+	// Text is the contents of the line, without the trailing newline
+	Text string
+	// Source is the file the line was read from. It is empty for STDIN.
+	Source string
+	// Offset is the byte offset in Source just past the end of the line, ie.
+	// where to pick up reading again once this line has been dealt with. For
+	// compressed files it is the offset in the decompressed contents.
+	Offset int64
+	// Fields are added to the event made from the line. They describe where
+	// the line came from when that isn't a file, like the address of the host
+	// that sent it.
+	Fields map[string]interface{}
+	// Dataset is the dataset the event made from the line goes to, when it
+	// isn't the one given by --dataset
+	Dataset string
+}
+
 // Event is a single log event
 type Event struct {
 	// Timestamp is the time of the event (may be different from current time)
@@ -16,4 +35,10 @@ type Event struct {
 	// Data is a map[string]interface{} containing key/value pairs for all the
 	// metrics to submit in this event
 	Data map[string]interface{}
+	// Source and Offset are copied from the last line that went into this
+	// event, so the event can be traced back to where it was read
+	Source string
+	Offset int64
+	// Dataset overrides the configured dataset when it's set
+	Dataset string
 }
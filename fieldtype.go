@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+)
+
+// converters convert a value to each of the types of --field_type, returning
+// false if they can't
+var converters = map[string]func(v interface{}) (interface{}, bool){
+	"int":       toInt,
+	"float":     toFloat,
+	"bool":      toBool,
+	"string":    toString,
+	"duration":  toDuration,
+	"bytes":     toBytes,
+	"timestamp": toTimestamp,
+}
+
+// fieldType converts the value of a field to a type, for --field_type
+type fieldType struct {
+	field   string
+	typ     string
+	convert func(v interface{}) (interface{}, bool)
+}
+
+// newFieldTypes parses --field_type
+func newFieldTypes(options GlobalOptions) ([]fieldType, error) {
+	var fieldTypes []fieldType
+	for _, ft := range options.FieldTypes {
+		splitFT := strings.SplitN(ft, "=", 2)
+		if len(splitFT) != 2 || splitFT[0] == "" {
+			return nil, fmt.Errorf("unable to separate --field_type %s into a field=type pair", ft)
+		}
+		convert, ok := converters[splitFT[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s in --field_type %s, should be one of int, float, bool, string, duration, bytes or timestamp", splitFT[1], ft)
+		}
+		fieldTypes = append(fieldTypes, fieldType{
+			field:   splitFT[0],
+			typ:     splitFT[1],
+			convert: convert,
+		})
+	}
+	return fieldTypes, nil
+}
+
+// apply converts the field of ev, if it's there. A value that doesn't convert
+// is left alone and counted in stats.
+func (ft fieldType) apply(ev *event.Event, stats *responseStats) {
+	val, ok := ev.Data[ft.field]
+	if !ok || val == nil {
+		return
+	}
+	converted, ok := ft.convert(val)
+	if !ok {
+		stats.countFieldTypeError(ft.field)
+		return
+	}
+	ev.Data[ft.field] = converted
+}
+
+func toInt(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		// float64(math.MaxInt64) rounds up to 1<<63, which doesn't fit
+		if v != math.Trunc(v) || v >= 1<<63 || v < -(1<<63) {
+			return nil, false
+		}
+		return int64(v), true
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, true
+		}
+		// whole numbers written as floats, eg. 3.0
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return toInt(f)
+		}
+	}
+	return nil, false
+}
+
+func toFloat(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func toBool(v interface{}) (interface{}, bool) {
+	if b, ok := v.(bool); ok {
+		return b, true
+	}
+	// strings and the numbers 0 and 1
+	if b, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprint(v))); err == nil {
+		return b, true
+	}
+	return nil, false
+}
+
+func toString(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		// without an exponent, so big IDs come out whole
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		return string(b), true
+	}
+	return fmt.Sprint(v), true
+}
+
+// toDuration converts durations like 1.5s or 250ms to milliseconds. Numbers
+// are left as they are, as there's no telling what unit they're in.
+func toDuration(v interface{}) (interface{}, bool) {
+	if s, ok := v.(string); ok {
+		if d, err := time.ParseDuration(strings.TrimSpace(s)); err == nil {
+			return float64(d) / float64(time.Millisecond), true
+		}
+	}
+	return toFloat(v)
+}
+
+// bytesRegex matches sizes like 10KB, 1.5 MiB or 512
+var bytesRegex = regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*([a-zA-Z]*)$`)
+
+// byteUnits are the multipliers of the units of sizes, lowercased. KB is a
+// thousand bytes and KiB is 1024 of them.
+var byteUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "ti": 1 << 40, "tib": 1 << 40,
+}
+
+// toBytes converts sizes like 10KB or 1.5MiB to a number of bytes
+func toBytes(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return toInt(v)
+	}
+	match := bytesRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return nil, false
+	}
+	unit, ok := byteUnits[strings.ToLower(match[2])]
+	if !ok {
+		return nil, false
+	}
+	n, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return nil, false
+	}
+	return int64(math.Round(n * unit)), true
+}
+
+// toTimestamp converts the formats of timestamp honeytail recognizes, and
+// unix times, to a time
+func toTimestamp(v interface{}) (interface{}, bool) {
+	var s string
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		s = strings.TrimSpace(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64:
+		s = fmt.Sprint(v)
+	default:
+		return nil, false
+	}
+	ts := httime.GuessTime(s)
+	if ts.IsZero() {
+		return nil, false
+	}
+	return ts, true
+}
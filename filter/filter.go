@@ -0,0 +1,494 @@
+// Package filter compiles the expressions of --filter, which pick the events
+// to send by their fields, eg.
+//
+//	status >= 500 || path =~ "^/api"
+//
+// Fields are compared to each other or to strings, numbers, true and false
+// with ==, !=, <, <=, > and >=. Numbers compare as numbers, including fields
+// that hold numbers as strings, and strings compare as strings. =~ and !~
+// match a field against a regex, which must be a string. A field on its own is
+// true when the event has it. Expressions are combined with &&, || and !, and
+// grouped with parentheses.
+//
+// Strings are "double quoted", with Go escapes, or 'single quoted', without
+// escapes, which is handy for regexes. Field names with characters other than
+// letters, digits, _ and . go in `backquotes`.
+//
+// Any comparison or match with a field the event doesn't have is false.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled filter expression
+type Filter struct {
+	expr string
+	root node
+}
+
+// Compile parses and checks expr, and compiles its regexes
+func Compile(expr string) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %s", expr, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %s", expr, err)
+	}
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// Match returns true if the fields in data match the filter
+func (f *Filter) Match(data map[string]interface{}) bool {
+	return f.root.eval(data)
+}
+
+// String returns the expression the filter was compiled from
+func (f *Filter) String() string {
+	return f.expr
+}
+
+/* lexing */
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokField
+	tokString
+	tokNumber
+	tokBool
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// value is the string, number or bool of a literal, or the name of a field
+	value interface{}
+	pos   int
+}
+
+// ops are the operators, longest first so they're matched greedily
+var ops = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!"}
+
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			s, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string %s at column %d: %s", expr[i:end+1], i+1, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: expr[i : end+1], value: s, pos: i})
+			i = end + 1
+		case c == '\'' || c == '`':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c at column %d", c, i+1)
+			}
+			text := expr[i : i+end+2]
+			kind := tokString
+			if c == '`' {
+				kind = tokField
+			}
+			tokens = append(tokens, token{kind: kind, text: text, value: text[1 : len(text)-1], pos: i})
+			i += end + 2
+		case c == '-' || c == '.' || isDigit(c):
+			end := i + 1
+			for end < len(expr) && (isDigit(expr[end]) || strings.IndexByte(".eE", expr[end]) >= 0 ||
+				((expr[end] == '-' || expr[end] == '+') && (expr[end-1] == 'e' || expr[end-1] == 'E'))) {
+				end++
+			}
+			n, err := strconv.ParseFloat(expr[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %s at column %d", expr[i:end], i+1)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:end], value: n, pos: i})
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(expr) && (isIdentStart(expr[end]) || isDigit(expr[end]) || expr[end] == '.') {
+				end++
+			}
+			text := expr[i:end]
+			switch text {
+			case "true", "false":
+				tokens = append(tokens, token{kind: tokBool, text: text, value: text == "true", pos: i})
+			default:
+				tokens = append(tokens, token{kind: tokField, text: text, value: text, pos: i})
+			}
+			i = end
+		default:
+			op := ""
+			for _, o := range ops {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of filter", pos: len(expr)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+/* parsing */
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == op
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	return fmt.Errorf("unexpected %s at column %d", t.text, t.pos+1)
+}
+
+// parseOr parses a || b || ...
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses a && b && ...
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// parseNot parses !a, a parenthesized expression, a comparison or a field
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.unexpected()
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses a comparison, a regex match, or a field or bool on
+// its own
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || t.text == "&&" || t.text == "||" || t.text == "!" {
+		switch left := left.(type) {
+		case field:
+			return existsNode{left}, nil
+		case literal:
+			if b, ok := left.v.(bool); ok {
+				return constNode(b), nil
+			}
+		}
+		return nil, fmt.Errorf("%s on its own at column %d, expected a field or a comparison", p.tokens[p.pos-1].text, p.tokens[p.pos-1].pos+1)
+	}
+	p.next()
+	if t.text == "=~" || t.text == "!~" {
+		pattern := p.next()
+		if pattern.kind != tokString {
+			return nil, fmt.Errorf("%s at column %d needs a string regex, got %s", t.text, t.pos+1, pattern.text)
+		}
+		re, err := regexp.Compile(pattern.value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("bad regex %s at column %d: %s", pattern.text, pattern.pos+1, err)
+		}
+		return matchNode{operand: left, re: re, negate: t.text == "!~"}, nil
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{op: t.text, left: left, right: right}, nil
+}
+
+// parseOperand parses a field or a literal
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokField:
+		p.next()
+		return field(t.value.(string)), nil
+	case tokString, tokNumber, tokBool:
+		p.next()
+		return literal{t.value}, nil
+	}
+	return nil, p.unexpected()
+}
+
+/* evaluating */
+
+type node interface {
+	eval(data map[string]interface{}) bool
+}
+
+type operand interface {
+	// value returns the value of the operand, or false if it's a field the
+	// event doesn't have
+	value(data map[string]interface{}) (interface{}, bool)
+}
+
+type field string
+
+func (f field) value(data map[string]interface{}) (interface{}, bool) {
+	v, ok := data[string(f)]
+	return v, ok && v != nil
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) value(data map[string]interface{}) (interface{}, bool) {
+	return l.v, true
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(data map[string]interface{}) bool {
+	return n.left.eval(data) || n.right.eval(data)
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(data map[string]interface{}) bool {
+	return n.left.eval(data) && n.right.eval(data)
+}
+
+type notNode struct{ n node }
+
+func (n notNode) eval(data map[string]interface{}) bool {
+	return !n.n.eval(data)
+}
+
+type constNode bool
+
+func (n constNode) eval(data map[string]interface{}) bool {
+	return bool(n)
+}
+
+type existsNode struct{ f field }
+
+func (n existsNode) eval(data map[string]interface{}) bool {
+	_, ok := n.f.value(data)
+	return ok
+}
+
+type matchNode struct {
+	operand operand
+	re      *regexp.Regexp
+	negate  bool
+}
+
+func (n matchNode) eval(data map[string]interface{}) bool {
+	v, ok := n.operand.value(data)
+	if !ok {
+		return false
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	return n.re.MatchString(s) != n.negate
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (n compareNode) eval(data map[string]interface{}) bool {
+	a, ok := n.left.value(data)
+	if !ok {
+		return false
+	}
+	b, ok := n.right.value(data)
+	if !ok {
+		return false
+	}
+	cmp, ok := compare(a, b)
+	if !ok {
+		// values that can't be compared are only ever unequal
+		return n.op == "!="
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or more than b, or
+// false if they can't be compared. Bools can be compared, but only for
+// equality, so they're never less or more.
+func compare(a, b interface{}) (int, bool) {
+	as, aIsString := a.(string)
+	bs, bIsString := b.(string)
+	if aIsString && bIsString {
+		return strings.Compare(as, bs), true
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok && ab == bb {
+			return 0, true
+		}
+		return 0, false
+	}
+	af, ok := toNumber(a)
+	if !ok {
+		return 0, false
+	}
+	bf, ok := toNumber(b)
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	}
+	return 0, true
+}
+
+// toNumber converts numbers, and strings that hold numbers, to float64
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
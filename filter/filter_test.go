@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	data := map[string]interface{}{
+		"status":      500,
+		"path":        "/api/users",
+		"duration_ms": 12.5,
+		"code":        "404",
+		"ok":          false,
+		"user.name":   "pikachu",
+		"weird-name":  "yes",
+		"nothing":     nil,
+	}
+	testCases := []struct {
+		expr  string
+		match bool
+	}{
+		{`status >= 500`, true},
+		{`status > 500`, false},
+		{`status == 500`, true},
+		{`status != 500`, false},
+		{`status < 500.5`, true},
+		{`duration_ms <= 12.5`, true},
+		{`code == 404`, true},
+		{`code > 40`, true},
+		{`code == "404"`, true},
+		{`path == "/api/users"`, true},
+		{`path < "/b"`, true},
+		{`path =~ "^/api"`, true},
+		{`path =~ '^/api/\w+$'`, true},
+		{`path !~ "^/api"`, false},
+		{`status =~ "^5"`, true},
+		{`status >= 500 || path =~ "^/api"`, true},
+		{`status < 500 || path =~ "^/web"`, false},
+		{`status >= 500 && path =~ "^/web"`, false},
+		{`!(status >= 500 && path =~ "^/web")`, true},
+		{`status < 500 || path =~ "^/api" && ok == false`, true},
+		{`(status < 500 || path =~ "^/api") && ok`, true},
+		{`ok == false`, true},
+		{`ok == true`, false},
+		{`ok != true`, true},
+		{`ok > false`, false},
+		{`status`, true},
+		{`!missing`, true},
+		{`nothing`, false},
+		{`user.name == "pikachu"`, true},
+		{"`weird-name` == 'yes'", true},
+		{`true`, true},
+		{`!true || false`, false},
+		{`status == path`, false},
+		{`status != path`, true},
+		// comparisons with missing fields are always false
+		{`missing == 1`, false},
+		{`missing != 1`, false},
+		{`missing !~ "x"`, false},
+		{`!(missing == 1)`, true},
+	}
+	for _, tc := range testCases {
+		f, err := Compile(tc.expr)
+		if !assert.Nil(t, err, tc.expr) {
+			continue
+		}
+		assert.Equal(t, tc.match, f.Match(data), tc.expr)
+		assert.Equal(t, tc.expr, f.String())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`status >=`,
+		`status >= 500 ||`,
+		`(status >= 500`,
+		`status >= 500)`,
+		`status 500`,
+		`"pikachu"`,
+		`500`,
+		`path =~ path`,
+		`path =~ "("`,
+		`path == "unterminated`,
+		`path == 'unterminated`,
+		"`unterminated",
+		`status >= 5e`,
+		`status # 500`,
+		`&& status`,
+	} {
+		_, err := Compile(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
@@ -179,6 +179,59 @@ func GetTimestamp(m map[string]interface{}, timeFieldName, timeFieldFormat strin
 	return ts
 }
 
+// FindTimestamp is like GetTimestamp, but reports whether a timestamp was
+// found instead of returning the current time, and doesn't warn about fields
+// that don't parse. The time field is deleted from the map if found.
+func FindTimestamp(m map[string]interface{}, timeFieldName, timeFieldFormat string) (time.Time, bool) {
+	if timeFieldName == "" {
+		for _, timeField := range possibleTimeFieldNames {
+			if timeStr, ok := m[timeField].(string); ok {
+				if ts := tryTimeFormats(timeStr, timeFieldFormat); !ts.IsZero() {
+					delete(m, timeField)
+					return ts, true
+				}
+			}
+		}
+		return time.Time{}, false
+	}
+	var ts time.Time
+	switch v := m[timeFieldName].(type) {
+	case string:
+		ts = tryTimeFormats(v, timeFieldFormat)
+	case int:
+		ts = tryTimeFormats(strconv.Itoa(v), timeFieldFormat)
+	case float64:
+		ts = tryTimeFormats(strconv.FormatFloat(v, 'f', -1, 64), timeFieldFormat)
+	case time.Time:
+		ts = v
+	}
+	if ts.IsZero() {
+		return time.Time{}, false
+	}
+	delete(m, timeFieldName)
+	return ts, true
+}
+
+// HasTimestamp reports whether GetTimestamp would find a timestamp in the
+// event map when guessing at the key name, without changing the map or
+// warning about fields that don't parse.
+func HasTimestamp(m map[string]interface{}) bool {
+	for _, timeField := range possibleTimeFieldNames {
+		if timeStr, ok := m[timeField].(string); ok {
+			if !tryTimeFormats(timeStr, "").IsZero() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GuessTime parses timespec the way GetTimestamp does when it isn't given a
+// format, returning the zero time if it doesn't look like a time
+func GuessTime(timespec string) time.Time {
+	return tryTimeFormats(timespec, "")
+}
+
 // Parse wraps time.ParseInLocation to use httime's Location from parsers
 func Parse(format, timespec string) (time.Time, error) {
 	return time.ParseInLocation(format, timespec, Location)
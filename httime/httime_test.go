@@ -274,6 +274,49 @@ func TestGetTimestampTypeTime(t *testing.T) {
 	}
 }
 
+func TestHasTimestamp(t *testing.T) {
+	m := map[string]interface{}{"time": "2014-03-10T12:57:38Z", "a": "b"}
+	if !HasTimestamp(m) {
+		t.Error("expected a timestamp in the time field")
+	}
+	if len(m) != 2 {
+		t.Errorf("expected the map to be unchanged, got %v", m)
+	}
+	for _, m := range []map[string]interface{}{
+		{"a": "2014-03-10T12:57:38Z"},
+		{"time": "yesterday"},
+		{"time": 1394481458},
+	} {
+		if HasTimestamp(m) {
+			t.Errorf("expected no timestamp in %v", m)
+		}
+	}
+}
+
+func TestFindTimestamp(t *testing.T) {
+	m := map[string]interface{}{"when": "10/03/2014 12:57:38", "time": "2014-03-10T12:57:38Z"}
+	ts, ok := FindTimestamp(m, "when", "%d/%m/%Y %H:%M:%S")
+	if !ok || !ts.Equal(time.Date(2014, 3, 10, 12, 57, 38, 0, time.UTC)) {
+		t.Errorf("got %v, %v from the configured field", ts, ok)
+	}
+	if _, ok := m["when"]; ok || len(m) != 1 {
+		t.Errorf("expected only the time field to be deleted, got %v", m)
+	}
+	if _, ok := FindTimestamp(map[string]interface{}{"when": "2014-03-10T12:57:38Z"}, "", ""); ok {
+		t.Error("expected no timestamp where the names of time fields aren't")
+	}
+	if _, ok := FindTimestamp(map[string]interface{}{"time": "2014-03-10T12:57:38Z"}, "when", ""); ok {
+		t.Error("expected no timestamp without the configured field")
+	}
+	if _, ok := FindTimestamp(map[string]interface{}{"time": "yesterday"}, "", ""); ok {
+		t.Error("expected no timestamp from a time field that doesn't parse")
+	}
+	ts, ok = FindTimestamp(map[string]interface{}{"time": "2014-03-10T12:57:38Z"}, "", "")
+	if !ok || ts.Unix() != 1394456258 {
+		t.Errorf("got %v, %v guessing the time field", ts, ok)
+	}
+}
+
 func TestCommaInTimestamp(t *testing.T) {
 	commaTimes := []testTimestamp{
 		{ // test commas as the fractional portion separator
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -17,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -27,17 +29,11 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/filter"
+	"github.com/honeycombio/honeytail/multiline"
 	"github.com/honeycombio/honeytail/parsers"
-	"github.com/honeycombio/honeytail/parsers/arangodb"
-	"github.com/honeycombio/honeytail/parsers/csv"
-	"github.com/honeycombio/honeytail/parsers/htjson"
-	"github.com/honeycombio/honeytail/parsers/keyval"
-	"github.com/honeycombio/honeytail/parsers/mongodb"
-	"github.com/honeycombio/honeytail/parsers/mysql"
-	"github.com/honeycombio/honeytail/parsers/nginx"
-	"github.com/honeycombio/honeytail/parsers/postgresql"
-	"github.com/honeycombio/honeytail/parsers/regex"
-	"github.com/honeycombio/honeytail/parsers/syslog"
+	"github.com/honeycombio/honeytail/pipeline"
+	"github.com/honeycombio/honeytail/receiver"
 	"github.com/honeycombio/honeytail/sample"
 	"github.com/honeycombio/honeytail/tail"
 )
@@ -51,26 +47,76 @@ expected behavior, it is possible that if there are other sources sending data t
 result in events being dropped. 
 `
 
-var previouslyRateLimited = false
+// previouslyRateLimited is set once rateLimitMessageBackoff has been logged.
+// Each client handles its responses in a goroutine of its own.
+var previouslyRateLimited atomic.Bool
 
-// actually go and be leashy
-func run(ctx context.Context, options GlobalOptions, rng *rand.Rand) {
-	logrus.Info("Starting honeytail")
+// sink sends the events of one pipeline to its dataset
+type sink struct {
+	options GlobalOptions
+	// client is shared with any other pipelines sending to the same write key
+	// and dataset
+	client *libhoney.Client
+	stats  *responseStats
 
-	stats := newResponseStats()
+	// two channels shared by all the senders to handle backing off when rate
+	// limited and resending failed send attempts that are recoverable
+	toBeResent chan event.Event
+	// time in milliseconds to delay the send
+	delaySending chan int
 
-	sigs := make(chan os.Signal, 1)
-	ctx, cancel := context.WithCancel(ctx)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	// with --tail.commit_on_ack, keep track of which events have been
+	// acknowledged to know what to save in the statefiles
+	acks           *ackTracker
+	doneCommitting chan struct{}
+	committingWG   sync.WaitGroup
+}
 
-	// spin up our transmission to send events to Honeycomb
-	libhConfig := libhoney.Config{
-		WriteKey:             options.Reqs.WriteKey,
-		Dataset:              options.Reqs.Dataset,
-		APIHost:              options.APIHost,
-		MaxConcurrentBatches: options.NumSenders,
-		SendFrequency:        time.Duration(options.BatchFrequencyMs) * time.Millisecond,
+func newSink(options GlobalOptions, client *libhoney.Client) *sink {
+	s := &sink{
+		options:        options,
+		client:         client,
+		stats:          newResponseStats(),
+		toBeResent:     make(chan event.Event, 2*options.NumSenders),
+		delaySending:   make(chan int, 2*options.NumSenders),
+		doneCommitting: make(chan struct{}),
+	}
+	s.stats.pipeline = options.Name
+	s.stats.lagWarningBytes = options.Tail.LagWarningBytes
+	s.stats.lagWarningSeconds = options.Tail.LagWarningSeconds
+	s.stats.noSecondsBehind = options.RebaseTime || options.Backfill || options.BackfillStart != ""
+	s.stats.files = options.Reqs.LogFiles
+	if options.Tail.CommitOnAck {
+		s.acks = newAckTracker()
+		s.committingWG.Add(1)
+		go func() {
+			s.acks.commitEvery(time.Second, s.doneCommitting)
+			s.committingWG.Done()
+		}()
+	}
+	go logStats(s.stats, options.StatusInterval)
+	return s
+}
+
+// sentEvent is the metadata given to libhoney with each event, to know which
+// pipeline its response belongs to
+type sentEvent struct {
+	event.Event
+	sink *sink
+}
+
+// clientKey is what pipelines have to have in common to share a client
+type clientKey struct {
+	writeKey string
+	dataset  string
+}
+
+// newClient spins up a transmission to send events to Honeycomb
+func newClient(options GlobalOptions) (*libhoney.Client, error) {
+	tx := &transmission.Honeycomb{
 		MaxBatchSize:         options.BatchSize,
+		BatchTimeout:         time.Duration(options.BatchFrequencyMs) * time.Millisecond,
+		MaxConcurrentBatches: options.NumSenders,
 		// block on send should be true so if we can't send fast enough, we slow
 		// down reading the log rather than drop lines.
 		BlockOnSend: true,
@@ -81,44 +127,99 @@ func run(ctx context.Context, options GlobalOptions, rng *rand.Rand) {
 		// limit pending work capacity so that we get backpressure from libhoney
 		// and block instead of sleeping inside sendToLibHoney.
 		PendingWorkCapacity: 20 * options.NumSenders,
+		UserAgentAddition:   libhoney.UserAgentAddition,
 	}
-	if options.DebugOut {
-		libhConfig.Output = &libhoney.WriterOutput{}
+	// use the same defaults as libhoney.Init for anything unset
+	if tx.MaxBatchSize == 0 {
+		tx.MaxBatchSize = libhoney.DefaultMaxBatchSize
 	}
-	if err := libhoney.Init(libhConfig); err != nil {
-		logrus.WithFields(logrus.Fields{"err": err}).Fatal(
-			"Error occurred while spinning up Transmission")
+	if tx.BatchTimeout == 0 {
+		tx.BatchTimeout = libhoney.DefaultBatchTimeout
 	}
-
-	if options.Backfill {
-		logrus.Info(backfillMessage)
+	if tx.MaxConcurrentBatches == 0 {
+		tx.MaxConcurrentBatches = libhoney.DefaultMaxConcurrentBatches
 	}
-
-	// compile the prefix regex once for use on all channels
-	var prefixRegex *parsers.ExtRegexp
-	if options.PrefixRegex == "" {
-		prefixRegex = nil
-	} else {
-		prefixRegex = &parsers.ExtRegexp{regexp.MustCompile(options.PrefixRegex)}
+	if tx.PendingWorkCapacity == 0 {
+		tx.PendingWorkCapacity = libhoney.DefaultPendingWorkCapacity
 	}
+	var sender transmission.Sender = tx
+	if options.DebugOut {
+		sender = &debugSender{WriterSender: transmission.WriterSender{BlockOnResponses: true}}
+	}
+	return libhoney.NewClient(libhoney.ClientConfig{
+		APIKey:       options.Reqs.WriteKey,
+		Dataset:      options.Reqs.Dataset,
+		APIHost:      options.APIHost,
+		Transmission: sender,
+	})
+}
 
-	// get our lines channel from which to read log lines
-	var linesChans []chan string
-	var err error
-	tc := tail.Config{
-		Paths:       options.Reqs.LogFiles,
-		FilterPaths: options.FilterFiles,
-		Type:        tail.RotateStyleSyslog,
-		Options:     options.Tail,
+// debugSender prints events to STDOUT for --debug_stdout. Unlike the
+// WriterSender it wraps, it closes its responses once stopped, the same as
+// the Honeycomb transmission.
+type debugSender struct {
+	transmission.WriterSender
+}
+
+func (d *debugSender) Stop() error {
+	err := d.WriterSender.Stop()
+	close(d.TxResponses())
+	return err
+}
+
+// actually go and be leashy
+func run(ctx context.Context, options GlobalOptions, rng *rand.Rand) {
+	runPipelines(ctx, []GlobalOptions{options}, rng)
+}
+
+// runPipelines runs each of pipelines until they've all finished
+func runPipelines(ctx context.Context, pipelinesOptions []GlobalOptions, rng *rand.Rand) {
+	logrus.Info("Starting honeytail")
+
+	sigs := make(chan os.Signal, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	// pipelines sending to the same write key and dataset share a client, and
+	// with it a transmission
+	clients := make(map[clientKey]*libhoney.Client)
+	sinks := make([]*sink, 0, len(pipelinesOptions))
+	unparsedOutputs := make([]*unparsedOutput, 0, len(pipelinesOptions))
+	pipelines := make([]*pipeline.Pipeline, 0, len(pipelinesOptions))
+	backfill := false
+	for _, options := range pipelinesOptions {
+		key := clientKey{writeKey: options.Reqs.WriteKey, dataset: options.Reqs.Dataset}
+		client, ok := clients[key]
+		if !ok {
+			var err error
+			if client, err = newClient(options); err != nil {
+				logrus.WithFields(logrus.Fields{"err": err}).Fatal(
+					"Error occurred while spinning up Transmission")
+			}
+			clients[key] = client
+		}
+		s := newSink(options, client)
+		unparsed, err := newUnparsedOutput(options, s)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"err": err, "pipeline": options.Name}).Fatal(
+				"Error occurred while opening --unparsed_output")
+		}
+		sinks = append(sinks, s)
+		unparsedOutputs = append(unparsedOutputs, unparsed)
+		pipelines = append(pipelines, newPipeline(options, s, unparsed, rng))
+		backfill = backfill || options.Backfill
 	}
-	if options.TailSample {
-		linesChans, err = tail.GetSampledEntries(ctx, tc, options.SampleRate, rng)
-	} else {
-		linesChans, err = tail.GetEntries(ctx, tc)
+
+	if backfill {
+		logrus.Info(backfillMessage)
 	}
-	if err != nil {
-		logrus.WithFields(logrus.Fields{"err": err}).Fatal(
-			"Error occurred while trying to tail logfile")
+
+	// start reading log lines
+	for i, p := range pipelines {
+		if err := p.Start(ctx); err != nil {
+			logrus.WithFields(logrus.Fields{"err": err, "pipeline": pipelinesOptions[i].Name}).Fatal(
+				"Error occurred while trying to tail logfile")
+		}
 	}
 
 	// set up our signal handler and support canceling
@@ -138,143 +239,426 @@ func run(ctx context.Context, options GlobalOptions, rng *rand.Rand) {
 		}
 	}()
 
-	// for each channel we got back from tail.GetEntries, spin up a parser.
-	parsersWG := sync.WaitGroup{}
+	// start a goroutine for each client that reads from responses and logs.
 	responsesWG := sync.WaitGroup{}
-	for _, lines := range linesChans {
-		// get our parser
-		parser, opts := getParserAndOptions(options)
-		if parser == nil {
-			logrus.WithFields(logrus.Fields{"parser": options.Reqs.ParserName}).Fatal(
-				"Parser not found. Use --list to show valid parsers")
-		}
+	for _, client := range clients {
+		responsesWG.Add(1)
+		go func(responses chan transmission.Response) {
+			handleResponses(responses)
+			responsesWG.Done()
+		}(client.TxResponses())
+	}
 
-		// and initialize it
-		if err := parser.Init(opts); err != nil {
-			logrus.Fatalf(
-				"Error initializing %s parser module: %v", options.Reqs.ParserName, err)
-		}
+	pipelinesWG := sync.WaitGroup{}
+	for i, p := range pipelines {
+		pipelinesWG.Add(1)
+		go func(p *pipeline.Pipeline, unparsed *unparsedOutput, name string) {
+			if err := p.Wait(); err != nil {
+				logrus.WithFields(logrus.Fields{"err": err, "pipeline": name}).Fatal(
+					"Error occurred while running pipeline")
+			}
+			unparsed.close()
+			pipelinesWG.Done()
+		}(p, unparsedOutputs[i], pipelinesOptions[i].Name)
+	}
+	pipelinesWG.Wait()
+	// tell libhoney to finish up sending events
+	for _, client := range clients {
+		client.Close()
+	}
+	// print out what we've done one last time
+	responsesWG.Wait()
+	for _, s := range sinks {
+		s.finish()
+	}
 
-		// create a channel for sending events into libhoney
-		toBeSent := make(chan event.Event, options.NumSenders)
-		doneSending := make(chan bool)
+	// Nothing bad happened, yay
+	logrus.Info("Honeytail is all done, goodbye!")
+}
 
-		// two channels to handle backing off when rate limited and resending failed
-		// send attempts that are recoverable
-		toBeResent := make(chan event.Event, 2*options.NumSenders)
-		// time in milliseconds to delay the send
-		delaySending := make(chan int, 2*options.NumSenders)
+// newPipeline sets up a pipeline that parses the lines of the configured
+// files or input and sends the events to s, and the lines that fail to parse
+// to unparsed
+func newPipeline(options GlobalOptions, s *sink, unparsed *unparsedOutput, rng *rand.Rand) *pipeline.Pipeline {
+	// compile the prefix regex once for use on all channels
+	var prefixRegex *parsers.ExtRegexp
+	if options.PrefixRegex == "" {
+		prefixRegex = nil
+	} else {
+		prefixRegex = &parsers.ExtRegexp{regexp.MustCompile(options.PrefixRegex)}
+	}
 
-		// apply any filters to the events before they get sent
-		modifiedToBeSent := modifyEventContents(toBeSent, options)
+	// with --backfill_start or --backfill_end, only events inside the window
+	// get sent
+	window, err := newTimeWindow(options)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"err": err}).Fatal(
+			"Error occurred while reading the backfill time window")
+	}
 
-		realToBeSent := make(chan event.Event, 10*options.NumSenders)
-		go func() {
-			wg := sync.WaitGroup{}
-			for i := uint(0); i < options.NumSenders; i++ {
-				wg.Add(1)
-				go func() {
-					for ev := range modifiedToBeSent {
-						realToBeSent <- ev
-					}
-					wg.Done()
-				}()
+	return &pipeline.Pipeline{
+		Source: pipeline.SourceFunc(func(ctx context.Context) (chan chan event.Line, error) {
+			return getLinesChans(ctx, options, rng)
+		}),
+		NewParser: func() (parsers.Parser, error) {
+			parser, opts := getParserAndOptions(options, unparsed.report)
+			if parser == nil {
+				return nil, fmt.Errorf("parser %s not found, use --list to show valid parsers", options.Reqs.ParserName)
 			}
-			wg.Wait()
-			close(realToBeSent)
-		}()
+			if err := parser.Init(opts); err != nil {
+				return nil, fmt.Errorf("error initializing %s parser module: %v", options.Reqs.ParserName, err)
+			}
+			return parser, nil
+		},
+		PrefixRegex: prefixRegex,
+		Wrap: func(lines chan event.Line, events chan event.Event) (chan event.Line, chan event.Event) {
+			// once a file passes the end of the time window, stop handing its
+			// lines to the parser
+			if window != nil {
+				pastEnd := make(chan struct{})
+				lines = stopLines(lines, pastEnd)
+				events = window.filterEvents(events, pastEnd)
+			}
+			if s.acks != nil {
+				events = s.acks.trackEvents(events)
+			}
+			return lines, events
+		},
+		Transforms: getTransforms(options, s.stats),
+		Sink:       s,
+		Workers:    int(options.NumSenders),
+	}
+}
 
-		// start up the sender. all sources are either sampled when tailing or in-
-		// parser, so always tell libhoney events are pre-sampled
-		go sendToLibhoney(ctx, realToBeSent, toBeResent, delaySending, doneSending)
+// finish saves how far the pipeline got and logs its stats one last time,
+// once all its events have had responses
+func (s *sink) finish() {
+	close(s.doneCommitting)
+	s.committingWG.Wait()
+	s.stats.log()
+	s.stats.logFinal()
+}
 
-		// start a goroutine that reads from responses and logs.
-		responses := libhoney.TxResponses()
-		responsesWG.Add(1)
+// getLinesChans sets up tailing for all the configured files. It returns a
+// channel of lines channels, one per tailed file, which is closed once no more
+// files will be added.
+func getLinesChans(ctx context.Context, options GlobalOptions, rng *rand.Rand) (chan chan event.Line, error) {
+	if options.Input == "syslog" || options.Input == "http" {
+		return getReceiverLinesChans(ctx, options, rng)
+	}
+	rotateStyle, err := tail.ParseRotateStyle(options.Tail.RotateStyle)
+	if err != nil {
+		return nil, err
+	}
+	var grouper *multiline.Grouper
+	if options.Multiline.Enabled() {
+		if grouper, err = multiline.New(options.Multiline); err != nil {
+			return nil, err
+		}
+	}
+	// when grouping lines into events, sample the events after they're grouped
+	// rather than the lines that go into them
+	tailSample := options.TailSample && grouper == nil
+	tc := tail.Config{
+		Paths:       options.Reqs.LogFiles,
+		FilterPaths: options.FilterFiles,
+		Type:        rotateStyle,
+		Options:     options.Tail,
+	}
+	if options.BackfillStart != "" && canSearchFiles(options) {
+		window, err := newTimeWindow(options)
+		if err != nil {
+			return nil, err
+		}
+		if tc.StartOffsets, err = findStartOffsets(options, window); err != nil {
+			return nil, err
+		}
+	}
+	if options.Tail.DiscoverFiles && !options.Tail.Stop && !options.Tail.Ordered && rotateStyle == tail.RotateStyleSyslog {
+		if tailSample {
+			return tail.WatchSampledEntries(ctx, tc, options.SampleRate, rng)
+		}
+		linesChans, err := tail.WatchEntries(ctx, tc)
+		if err != nil || grouper == nil {
+			return linesChans, err
+		}
+		groupedLinesChans := make(chan chan event.Line)
 		go func() {
-			handleResponses(responses, stats, toBeResent, delaySending, options)
-			responsesWG.Done()
+			defer close(groupedLinesChans)
+			for lines := range linesChans {
+				groupedLinesChans <- groupLines(lines, grouper, options, rng)
+			}
 		}()
+		return groupedLinesChans, nil
+	}
 
-		parsersWG.Add(1)
-		go func(plines chan string) {
-			// ProcessLines won't return until lines is closed
-			parser.ProcessLines(plines, toBeSent, prefixRegex)
-			// trigger the sending goroutine to finish up
-			close(toBeSent)
-			// wait for all the events in toBeSent to be handed to libhoney
-			<-doneSending
-			parsersWG.Done()
-		}(lines)
-	}
-	parsersWG.Wait()
-	// tell libhoney to finish up sending events
-	libhoney.Close()
-	// print out what we've done one last time
-	responsesWG.Wait()
-	stats.log()
-	stats.logFinal()
+	var linesChans []chan event.Line
+	if tailSample {
+		linesChans, err = tail.GetSampledEntries(ctx, tc, options.SampleRate, rng)
+	} else {
+		linesChans, err = tail.GetEntries(ctx, tc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the set of files is fixed, so hand them all over up front
+	allLinesChans := make(chan chan event.Line, len(linesChans))
+	for _, lines := range linesChans {
+		if grouper != nil {
+			lines = groupLines(lines, grouper, options, rng)
+		}
+		allLinesChans <- lines
+	}
+	close(allLinesChans)
+	return allLinesChans, nil
+}
 
-	// Nothing bad happened, yay
-	logrus.Info("Honeytail is all done, goodbye!")
+// getReceiverLinesChans listens for lines sent over the network with --input
+// set to syslog or http. All the lines arrive on a single lines channel.
+func getReceiverLinesChans(ctx context.Context, options GlobalOptions, rng *rand.Rand) (chan chan event.Line, error) {
+	var lines chan event.Line
+	var addr net.Addr
+	var err error
+	if options.Input == "syslog" {
+		lines, addr, err = receiver.ListenSyslog(ctx, options.Listen)
+	} else {
+		lines, addr, err = receiver.ListenHTTP(ctx, options.Listen, options.HTTP)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"input":   options.Input,
+		"address": addr.String(),
+	}).Info("Listening for log lines")
+	if options.TailSample && options.SampleRate > 1 {
+		lines = tail.SampleLines(lines, options.SampleRate, rng)
+	}
+	linesChans := make(chan chan event.Line, 1)
+	linesChans <- lines
+	close(linesChans)
+	return linesChans, nil
+}
+
+// groupLines groups the lines from one file into events, then samples those
+// events if sampling is done while tailing
+func groupLines(lines chan event.Line, grouper *multiline.Grouper, options GlobalOptions, rng *rand.Rand) chan event.Line {
+	grouped := grouper.Group(lines)
+	if options.TailSample && options.SampleRate > 1 {
+		return tail.SampleLines(grouped, options.SampleRate, rng)
+	}
+	return grouped
 }
 
 // getParserOptions takes a parser name and the global options struct
-// it returns the options group for the specified parser
-func getParserAndOptions(options GlobalOptions) (parsers.Parser, interface{}) {
-	var parser parsers.Parser
-	var opts interface{}
-	switch options.Reqs.ParserName {
-	case "regex":
-		parser = &regex.Parser{}
-		opts = &options.Regex
-		opts.(*regex.Options).NumParsers = int(options.NumSenders)
-	case "nginx":
-		parser = &nginx.Parser{}
-		opts = &options.Nginx
-		opts.(*nginx.Options).NumParsers = int(options.NumSenders)
-	case "json":
-		parser = &htjson.Parser{}
-		opts = &options.JSON
-		opts.(*htjson.Options).NumParsers = int(options.NumSenders)
-	case "keyval":
-		parser = &keyval.Parser{}
-		opts = &options.KeyVal
-		opts.(*keyval.Options).NumParsers = int(options.NumSenders)
-	case "mongo", "mongodb":
-		parser = &mongodb.Parser{}
-		opts = &options.Mongo
-		opts.(*mongodb.Options).NumParsers = int(options.NumSenders)
-	case "mysql":
-		parser = &mysql.Parser{
-			SampleRate: int(options.SampleRate),
-		}
-		opts = &options.MySQL
-		opts.(*mysql.Options).NumParsers = int(options.NumSenders)
-	case "postgresql":
-		opts = &options.PostgreSQL
-		parser = &postgresql.Parser{}
-	case "arangodb":
-		parser = &arangodb.Parser{}
-		opts = &options.ArangoDB
-	case "csv":
-		parser = &csv.Parser{}
-		opts = &options.CSV
-		opts.(*csv.Options).NumParsers = int(options.NumSenders)
-	case "syslog":
-		parser = &syslog.Parser{}
-		opts = &options.Syslog
-		opts.(*syslog.Options).NumParsers = int(options.NumSenders)
-	}
-	parser, _ = parser.(parsers.Parser)
-	return parser, opts
-}
-
-// modifyEventContents takes a channel from which it will read events. It
-// returns a channel on which it will send the munged events. It is responsible
-// for hashing or dropping or adding fields to the events and doing the dynamic
-// sampling, if enabled
-func modifyEventContents(toBeSent chan event.Event, options GlobalOptions) chan event.Event {
+// it returns the options group for the specified parser. The parser reports
+// the lines it fails to parse to unparsed, if it's set.
+func getParserAndOptions(options GlobalOptions, unparsed parsers.UnparsedFunc) (parsers.Parser, interface{}) {
+	r := parsers.Lookup(options.Reqs.ParserName)
+	if r == nil {
+		return nil, nil
+	}
+	settings := parsers.Settings{
+		NumParsers:      int(options.NumSenders),
+		SampleRate:      int(options.SampleRate),
+		Unparsed:        unparsed,
+		NoTypeInference: options.NoTypeInference,
+	}
+	if options.Tail.CommitOnAck {
+		// events have to come out of the parser in the same order as their
+		// lines went in to know which lines have been sent
+		settings.NumParsers = 1
+		settings.Ordered = true
+	}
+	return r.New(options.Parsers[r.Name], settings)
+}
+
+// getTransforms returns the transforms that munge the events of a pipeline,
+// in the order they're done: the steps listed in the transforms of the YAML
+// config, or the default order. Values that fail to convert to their
+// --field_type are counted in stats.
+func getTransforms(options GlobalOptions, stats *responseStats) []pipeline.Transform {
+	steps, err := getTransformSteps(options)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up the transforms")
+	}
+	var transforms []pipeline.Transform
+	for _, step := range steps {
+		transform := transformSteps[step.name].build(step.options, stats)
+		if transform == nil {
+			if step.listed {
+				logrus.WithField("step", step.name).
+					Warn("Transform step listed in the YAML config has nothing to do, skipping it")
+			}
+			continue
+		}
+		transforms = append(transforms, pipeline.TransformFunc(transform))
+	}
+	return transforms
+}
+
+// subparseTransform parses fields with other parsers, for --subparse
+func subparseTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	// set up the line parsers once instead of for every event
+	subparsers, err := newSubparsers(options)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up --subparse")
+	}
+	if len(subparsers) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, sp := range subparsers {
+			sp.subparse(ev, options.SubparseTimestamp)
+		}
+	}
+}
+
+// fieldTypeTransform gives fields the types they're meant to have, for
+// --field_type
+func fieldTypeTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	fieldTypes, err := newFieldTypes(options)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up --field_type")
+	}
+	if len(fieldTypes) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, ft := range fieldTypes {
+			ft.apply(ev, stats)
+		}
+	}
+}
+
+// filterTransform drops the events --filter doesn't want
+func filterTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if options.Filter == "" {
+		return nil
+	}
+	// compile the expression once instead of for every event
+	eventFilter, err := filter.Compile(options.Filter)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to compile --filter")
+	}
+	return func(ev *event.Event) {
+		// if both are true or both are false, drop. else keep
+		if eventFilter.Match(ev.Data) == options.InvertFilter {
+			ev.SampleRate = -1
+		}
+	}
+}
+
+// requestShapeTransform breaks apart the fields in --request_shape
+func requestShapeTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if len(options.RequestShape) == 0 {
+		return nil
+	}
+	// do all the advance work for request shaping
+	shaper := &requestShaper{pr: &urlshaper.Parser{}}
+	if options.ShapePrefix != "" {
+		shaper.prefix = options.ShapePrefix + "_"
+	}
+	for _, rpat := range options.RequestPattern {
+		pat := urlshaper.Pattern{Pat: rpat}
+		if err := pat.Compile(); err != nil {
+			logrus.WithField("request_pattern", rpat).WithError(err).Fatal(
+				"Failed to compile provided pattern.")
+		}
+		shaper.pr.Patterns = append(shaper.pr.Patterns, &pat)
+	}
+	return func(ev *event.Event) {
+		for _, field := range options.RequestShape {
+			shaper.requestShape(field, ev, options)
+		}
+	}
+}
+
+// augmentTransform adds the fields of the --da_map_file
+func augmentTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if options.DAMapFile == "" {
+		return nil
+	}
+	// initialize the data augmentation map
+	// map contents are sourceFieldValue -> object containing new keys and values
+	// {"sourceField":{"val1":{"newKey1":"newVal1","newKey2":"newVal2"},"val2":{"newKey1":"newValA"}}}
+	type DataAugmentationMap map[string]map[string]map[string]interface{}
+	var daMap DataAugmentationMap
+	raw, err := ioutil.ReadFile(options.DAMapFile)
+	if err != nil {
+		logrus.WithField("error", err).Fatal("failed to read Data Augmentation Map file")
+	}
+	err = json.Unmarshal(raw, &daMap)
+	if err != nil {
+		logrus.WithField("error", err).Fatal("failed to unmarshal Data Augmentation Map from JSON")
+	}
+	if daMap == nil {
+		return nil
+	}
+	// for each source column
+	return func(ev *event.Event) {
+		for sourceField, augmentableVals := range daMap {
+			// does that column exist in the event?
+			if val, ok := ev.Data[sourceField]; ok {
+				// if it does exist, is it a string?
+				if val, ok := val.(string); ok {
+					// if we have fields to augment this value
+					if newFields, ok := augmentableVals[val]; ok {
+						// go ahead and insert new fields
+						for k, v := range newFields {
+							ev.Data[k] = v
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// dropTransform drops the fields in --drop_field
+func dropTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if len(options.DropFields) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, field := range options.DropFields {
+			delete(ev.Data, field)
+		}
+	}
+}
+
+// redactTransform replaces the sensitive parts of string fields, for --redact
+func redactTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	redactor, err := newRedactor(options)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up --redact")
+	}
+	if redactor == nil {
+		return nil
+	}
+	return func(ev *event.Event) {
+		redactor.apply(ev, stats)
+	}
+}
+
+// scrubTransform hashes the fields in --scrub_field
+func scrubTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if len(options.ScrubFields) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, field := range options.ScrubFields {
+			if val, ok := ev.Data[field]; ok {
+				// generate a sha256 hash and use the base16 for the content
+				newVal := sha256.Sum256([]byte(fmt.Sprintf("%v", val)))
+				ev.Data[field] = fmt.Sprintf("%x", newVal)
+			}
+		}
+	}
+}
+
+// addTransform adds the fields in --add_field
+func addTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
 	// parse the addField bit once instead of for every event
 	parsedAddFields := map[string]string{}
 	for _, addField := range options.AddFields {
@@ -286,22 +670,19 @@ func modifyEventContents(toBeSent chan event.Event, options GlobalOptions) chan
 		}
 		parsedAddFields[splitField[0]] = splitField[1]
 	}
-	// do all the advance work for request shaping
-	shaper := &requestShaper{}
-	if len(options.RequestShape) != 0 {
-		shaper.pr = &urlshaper.Parser{}
-		if options.ShapePrefix != "" {
-			shaper.prefix = options.ShapePrefix + "_"
-		}
-		for _, rpat := range options.RequestPattern {
-			pat := urlshaper.Pattern{Pat: rpat}
-			if err := pat.Compile(); err != nil {
-				logrus.WithField("request_pattern", rpat).WithError(err).Fatal(
-					"Failed to compile provided pattern.")
-			}
-			shaper.pr.Patterns = append(shaper.pr.Patterns, &pat)
+	if len(parsedAddFields) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for k, v := range parsedAddFields {
+			ev.Data[k] = v
 		}
 	}
+}
+
+// sampleTransform sets the sample rate of every event, dropping the ones
+// sampled out
+func sampleTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
 	// initialize the dynamic sampler
 	var dynamicSampler dynsampler.Sampler
 	if len(options.DynSample) != 0 {
@@ -324,167 +705,117 @@ func modifyEventContents(toBeSent chan event.Event, options GlobalOptions) chan
 		}
 	}
 
-	// initialize the data augmentation map
-	// map contents are sourceFieldValue -> object containing new keys and values
-	// {"sourceField":{"val1":{"newKey1":"newVal1","newKey2":"newVal2"},"val2":{"newKey1":"newValA"}}}
-	type DataAugmentationMap map[string]map[string]map[string]interface{}
-	var daMap DataAugmentationMap
-	if options.DAMapFile != "" {
-		raw, err := ioutil.ReadFile(options.DAMapFile)
-		if err != nil {
-			logrus.WithField("error", err).Fatal("failed to read Data Augmentation Map file")
+	return func(ev *event.Event) {
+		// get presampled field if it exists
+		if options.PreSampledField != "" {
+			var presampledRate int
+			if psr, ok := ev.Data[options.PreSampledField]; ok {
+				switch psr := psr.(type) {
+				case float64:
+					presampledRate = int(psr)
+				case string:
+					if val, err := strconv.Atoi(psr); err == nil {
+						presampledRate = val
+					}
+				}
+			}
+			ev.SampleRate = presampledRate
+			return
 		}
-		err = json.Unmarshal(raw, &daMap)
-		if err != nil {
-			logrus.WithField("error", err).Fatal("failed to unmarshal Data Augmentation Map from JSON")
+		// do sampling
+		ev.SampleRate = int(options.SampleRate)
+		if dynamicSampler != nil {
+			key := makeDynsampleKey(ev, options)
+			sr := dynamicSampler.GetSampleRate(key)
+			if rand.Intn(sr) != 0 {
+				ev.SampleRate = -1
+			} else {
+				ev.SampleRate = sr
+			}
+		}
+		if deterministicSampler != nil {
+			sampleKey, ok := ev.Data[options.DeterministicSample].(string)
+			if !ok {
+				logrus.WithField("event_data", ev.Data).
+					WithField("field", options.DeterministicSample).
+					Error("Field to deterministically sample on does not exist in event, leaving it to random chance")
+				if rand.Intn(int(options.SampleRate)) != 0 {
+					ev.SampleRate = -1
+				}
+			} else {
+				if !deterministicSampler.Sample(sampleKey) {
+					ev.SampleRate = -1
+				}
+			}
 		}
 	}
+}
+
+// rebaseTransform moves the times of events relative to now, for
+// --rebase_time
+func rebaseTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if !options.RebaseTime {
+		return nil
+	}
+	baseTime, err := getBaseTime(options)
+	if err != nil {
+		logrus.WithError(err).Fatal("--rebase_time specified but cannot rebase")
+	}
+	startTime := time.Now()
+	return func(ev *event.Event) {
+		ev.Timestamp = rebaseTime(baseTime, startTime, ev.Timestamp)
+	}
+}
 
-	var baseTime, startTime time.Time
-	if options.RebaseTime {
-		var err error
-		baseTime, err = getBaseTime(options)
-		if err != nil {
-			logrus.WithError(err).Fatal("--rebase_time specified but cannot rebase")
+// jsonTransform unescapes the JSON strings in --json_field
+func jsonTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if len(options.JSONFields) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, field := range options.JSONFields {
+			jsonVal, ok := ev.Data[field].(string)
+			if !ok {
+				logrus.WithField("field", field).
+					Warn("Error asserting given field as string")
+				continue
+			}
+			var jsonMap map[string]interface{}
+			if err := json.Unmarshal([]byte(jsonVal), &jsonMap); err != nil {
+				logrus.WithField("field", field).
+					Warn("Error unmarshalling field as JSON")
+				continue
+			}
+
+			ev.Data[field] = jsonMap
 		}
-		startTime = time.Now()
 	}
+}
 
-	// ok, we need to munge events. Sing up enough goroutines to handle this
-	newSent := make(chan event.Event, options.NumSenders)
-	go func() {
-		wg := sync.WaitGroup{}
-		for i := uint(0); i < options.NumSenders; i++ {
-			wg.Add(1)
-			go func() {
-				for ev := range toBeSent {
-					// do request shaping
-					for _, field := range options.RequestShape {
-						shaper.requestShape(field, &ev, options)
-					}
-					// do data augmentation. For each source column
-					for sourceField, augmentableVals := range daMap {
-						// does that column exist in the event?
-						if val, ok := ev.Data[sourceField]; ok {
-							// if it does exist, is it a string?
-							if val, ok := val.(string); ok {
-								// if we have fields to augment this value
-								if newFields, ok := augmentableVals[val]; ok {
-									// go ahead and insert new fields
-									for k, v := range newFields {
-										ev.Data[k] = v
-									}
-								}
-							}
-						}
-					}
-					// do dropping
-					for _, field := range options.DropFields {
-						delete(ev.Data, field)
-					}
-					// do scrubbing
-					for _, field := range options.ScrubFields {
-						if val, ok := ev.Data[field]; ok {
-							// generate a sha256 hash and use the base16 for the content
-							newVal := sha256.Sum256([]byte(fmt.Sprintf("%v", val)))
-							ev.Data[field] = fmt.Sprintf("%x", newVal)
-						}
-					}
-					// do adding
-					for k, v := range parsedAddFields {
-						ev.Data[k] = v
-					}
-					// get presampled field if it exists
-					if options.PreSampledField != "" {
-						var presampledRate int
-						if psr, ok := ev.Data[options.PreSampledField]; ok {
-							switch psr := psr.(type) {
-							case float64:
-								presampledRate = int(psr)
-							case string:
-								if val, err := strconv.Atoi(psr); err == nil {
-									presampledRate = val
-								}
-							}
-						}
-						ev.SampleRate = presampledRate
-					} else {
-						// do sampling
-						ev.SampleRate = int(options.SampleRate)
-						if dynamicSampler != nil {
-							key := makeDynsampleKey(&ev, options)
-							sr := dynamicSampler.GetSampleRate(key)
-							if rand.Intn(sr) != 0 {
-								ev.SampleRate = -1
-							} else {
-								ev.SampleRate = sr
-							}
-						}
-						if deterministicSampler != nil {
-							sampleKey, ok := ev.Data[options.DeterministicSample].(string)
-							if !ok {
-								logrus.WithField("event_data", ev.Data).
-									WithField("field", options.DeterministicSample).
-									Error("Field to deterministically sample on does not exist in event, leaving it to random chance")
-								if rand.Intn(int(options.SampleRate)) != 0 {
-									ev.SampleRate = -1
-								}
-							} else {
-								if !deterministicSampler.Sample(sampleKey) {
-									ev.SampleRate = -1
-								}
-							}
-						}
-					}
-					if options.RebaseTime {
-						ev.Timestamp = rebaseTime(baseTime, startTime, ev.Timestamp)
-					}
-					if len(options.JSONFields) > 0 {
-						for _, field := range options.JSONFields {
-							jsonVal, ok := ev.Data[field].(string)
-							if !ok {
-								logrus.WithField("field", field).
-									Warn("Error asserting given field as string")
-								continue
-							}
-							var jsonMap map[string]interface{}
-							if err := json.Unmarshal([]byte(jsonVal), &jsonMap); err != nil {
-								logrus.WithField("field", field).
-									Warn("Error unmarshalling field as JSON")
-								continue
-							}
-
-							ev.Data[field] = jsonMap
-						}
-					}
-					if len(options.RenameFields) > 0 {
-						for _, kv := range options.RenameFields {
-							kvPair := strings.Split(kv, "=")
-							if len(kvPair) != 2 {
-								logrus.WithField("arg", kv).
-									Error("Invalid --rename_field arg. Should be format 'before=after' ")
-								continue
-							}
-							val, ok := ev.Data[kvPair[0]]
-							if !ok {
-								logrus.WithField("before_field", kvPair[0]).
-									WithField("after_field", kvPair[1]).
-									Error("Did not find before_field in event.")
-								continue
-							}
-							delete(ev.Data, kvPair[0])
-							ev.Data[kvPair[1]] = val
-						}
-					}
-					newSent <- ev
-				}
-				wg.Done()
-			}()
+// renameTransform renames the fields in --rename_field
+func renameTransform(options GlobalOptions, stats *responseStats) func(ev *event.Event) {
+	if len(options.RenameFields) == 0 {
+		return nil
+	}
+	return func(ev *event.Event) {
+		for _, kv := range options.RenameFields {
+			kvPair := strings.Split(kv, "=")
+			if len(kvPair) != 2 {
+				logrus.WithField("arg", kv).
+					Error("Invalid --rename_field arg. Should be format 'before=after' ")
+				continue
+			}
+			val, ok := ev.Data[kvPair[0]]
+			if !ok {
+				logrus.WithField("before_field", kvPair[0]).
+					WithField("after_field", kvPair[1]).
+					Error("Did not find before_field in event.")
+				continue
+			}
+			delete(ev.Data, kvPair[0])
+			ev.Data[kvPair[1]] = val
 		}
-		wg.Wait()
-		close(newSent)
-	}()
-	return newSent
+	}
 }
 
 // makeDynsampleKey pulls in all the values necessary from the event to create a
@@ -588,23 +919,22 @@ func whitelistKey(whiteKeys []string, key string) bool {
 	return false
 }
 
-// sendToLibhoney reads from the toBeSent channel and shoves the events into
+// SendEvents reads from the toBeSent channel and shoves the events into
 // libhoney events, sending them on their way.
-func sendToLibhoney(ctx context.Context, toBeSent chan event.Event, toBeResent chan event.Event,
-	delaySending chan int, doneSending chan bool) {
+func (s *sink) SendEvents(toBeSent <-chan event.Event) {
 	for {
 		// check and see if we need to back off the API because of rate limiting
 		select {
-		case delay := <-delaySending:
+		case delay := <-s.delaySending:
 			time.Sleep(time.Duration(delay) * time.Millisecond)
 		default:
 		}
 		// if we have events to retransmit, send those first
 		select {
-		case ev := <-toBeResent:
+		case ev := <-s.toBeResent:
 			// retransmitted events have already been sampled; always use
 			// SendPresampled() for these
-			sendEvent(ev)
+			s.sendEvent(ev)
 			continue
 		default:
 		}
@@ -614,10 +944,9 @@ func sendToLibhoney(ctx context.Context, toBeSent chan event.Event, toBeResent c
 			if !ok {
 				// channel is closed
 				// NOTE: any untransmitted retransmittable events will be dropped
-				doneSending <- true
 				return
 			}
-			sendEvent(ev)
+			s.sendEvent(ev)
 			continue
 		default:
 		}
@@ -626,19 +955,24 @@ func sendToLibhoney(ctx context.Context, toBeSent chan event.Event, toBeResent c
 	}
 }
 
-// sendEvent does the actual handoff to libhoney
-func sendEvent(ev event.Event) {
+// sendEvent does the actual handoff to libhoney. Events that never make it
+// to libhoney are marked done in acks right away.
+func (s *sink) sendEvent(ev event.Event) {
 	if ev.SampleRate == -1 {
 		// drop the event!
 		logrus.WithFields(logrus.Fields{
 			"event": ev,
 		}).Debug("dropped event due to sampling")
+		s.acks.done(ev)
 		return
 	}
-	libhEv := libhoney.NewEvent()
-	libhEv.Metadata = ev
+	libhEv := s.client.NewEvent()
+	libhEv.Metadata = sentEvent{Event: ev, sink: s}
 	libhEv.Timestamp = ev.Timestamp
 	libhEv.SampleRate = uint(ev.SampleRate)
+	if ev.Dataset != "" {
+		libhEv.Dataset = ev.Dataset
+	}
 	if err := libhEv.Add(ev.Data); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"event": ev,
@@ -650,39 +984,52 @@ func sendEvent(ev event.Event) {
 			"event": ev,
 			"error": err,
 		}).Error("Unexpected error event to libhoney send")
+		s.acks.done(ev)
 	}
 }
 
-// handleResponses reads from the response queue, logging a summary and debug
-// re-enqueues any events that failed to send in a retryable way
-func handleResponses(responses chan transmission.Response, stats *responseStats,
-	toBeResent chan event.Event, delaySending chan int,
-	options GlobalOptions) {
-	go logStats(stats, options.StatusInterval)
-
+// handleResponses reads from the response queue of a client, handing each
+// response to the sink of the pipeline its event came from
+func handleResponses(responses chan transmission.Response) {
 	for rsp := range responses {
-		stats.update(rsp)
-		logfields := logrus.Fields{
-			"status_code": rsp.StatusCode,
-			"body":        strings.TrimSpace(string(rsp.Body)),
-			"duration":    rsp.Duration,
-			"error":       rsp.Err,
-			"timestamp":   rsp.Metadata.(event.Event).Timestamp,
-		}
-		// if this is an error we should retry sending, re-enqueue the event
-		if options.BackOff && (rsp.StatusCode == 429 || rsp.StatusCode == 500) {
-			if !previouslyRateLimited && rsp.StatusCode == 429 {
-				logrus.Info(rateLimitMessageBackoff)
-				previouslyRateLimited = true
-			}
-			logfields["retry_send"] = true
-			delaySending <- 1000 / int(options.NumSenders) // back off for a little bit
-			toBeResent <- rsp.Metadata.(event.Event)       // then retry sending the event
-		} else {
-			logfields["retry_send"] = false
+		sent := rsp.Metadata.(sentEvent)
+		rsp.Metadata = sent.Event
+		sent.sink.handleResponse(rsp)
+	}
+}
+
+// handleResponse logs a summary and debug re-enqueues any events that failed
+// to send in a retryable way. Events that were accepted are marked done in
+// acks, if it's set.
+func (s *sink) handleResponse(rsp transmission.Response) {
+	s.stats.update(rsp)
+	logfields := logrus.Fields{
+		"status_code": rsp.StatusCode,
+		"body":        strings.TrimSpace(string(rsp.Body)),
+		"duration":    rsp.Duration,
+		"error":       rsp.Err,
+		"timestamp":   rsp.Metadata.(event.Event).Timestamp,
+	}
+	if s.options.Name != "" {
+		logfields["pipeline"] = s.options.Name
+	}
+	// if this is an error we should retry sending, re-enqueue the event
+	if s.options.BackOff && (rsp.StatusCode == 429 || rsp.StatusCode == 500) {
+		if rsp.StatusCode == 429 && previouslyRateLimited.CompareAndSwap(false, true) {
+			logrus.Info(rateLimitMessageBackoff)
+		}
+		logfields["retry_send"] = true
+		s.delaySending <- 1000 / int(s.options.NumSenders) // back off for a little bit
+		s.toBeResent <- rsp.Metadata.(event.Event)         // then retry sending the event
+	} else {
+		logfields["retry_send"] = false
+		if rsp.Err == nil && rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+			s.acks.done(rsp.Metadata.(event.Event))
+		} else if s.acks != nil {
+			logrus.WithFields(logfields).Warn("Failed to send event; its file's statefile won't move past it until honeytail restarts")
 		}
-		logrus.WithFields(logfields).Debug("event send record received")
 	}
+	logrus.WithFields(logfields).Debug("event send record received")
 }
 
 // logStats dumps and resets the stats once every minute
@@ -703,9 +1050,23 @@ func getBaseTime(options GlobalOptions) (time.Time, error) {
 
 	// support multiple files and globs, although this is unlikely to be used
 	searchFiles := []string{}
+	if options.Tail.Ordered {
+		// only the newest file in each rotation series has the latest time
+		allSeries, err := tail.OrderedPaths(tail.Config{
+			Paths:       options.Reqs.LogFiles,
+			FilterPaths: options.FilterFiles,
+			Options:     options.Tail,
+		})
+		if err != nil {
+			return baseTime, err
+		}
+		for _, files := range allSeries {
+			searchFiles = append(searchFiles, files[len(files)-1])
+		}
+	}
 	for _, f := range options.Reqs.LogFiles {
-		// can't work with stdin
-		if f == "-" {
+		// can't work with stdin, and ordered files were found above
+		if f == "-" || options.Tail.Ordered {
 			continue
 		}
 		// can't work with files that don't exist
@@ -718,9 +1079,9 @@ func getBaseTime(options GlobalOptions) (time.Time, error) {
 	}
 
 	// we're going to have to parse lines, so get an instance of the parser
-	parser, parserOpts := getParserAndOptions(options)
+	parser, parserOpts := getParserAndOptions(options, nil)
 	parser.Init(parserOpts)
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	events := make(chan event.Event)
 	var prefixRegex *parsers.ExtRegexp
 	if options.PrefixRegex == "" {
@@ -750,46 +1111,59 @@ func getBaseTime(options GlobalOptions) (time.Time, error) {
 	return baseTime, nil
 }
 
-func getEndLines(files []string, lines chan<- string) {
+func getEndLines(files []string, lines chan<- event.Line) {
 	for _, f := range files {
-		lines <- getEndLine(f)
+		lines <- event.Line{Text: getEndLine(f), Source: f}
 	}
 
 	close(lines)
 }
 
 func getEndLine(file string) string {
-	handle, err := os.Open(file)
-	if err != nil {
-		logrus.WithError(err).WithField("file", file).
-			Fatal("unable to open file")
-	}
-	defer handle.Close()
+	var reader io.Reader
+	if tail.IsCompressed(file) {
+		// compressed files can't be seeked, so we have to read the whole thing
+		handle, err := tail.OpenCompressed(file)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).
+				Fatal("unable to open file")
+		}
+		defer handle.Close()
+		reader = handle
+	} else {
+		handle, err := os.Open(file)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).
+				Fatal("unable to open file")
+		}
+		defer handle.Close()
 
-	info, err := os.Stat(file)
-	if err != nil {
-		logrus.WithError(err).WithField("file", file).
-			Fatal("unable to stat file")
-	}
-	// If we're bigger than 2m, zoom to the end of the file and go back 1mb
-	// 2m is an arbitrary limit
-	if info.Size() > 2*1024*1024 {
-		_, err := handle.Seek(-1024*1024, io.SeekEnd)
+		info, err := os.Stat(file)
 		if err != nil {
 			logrus.WithError(err).WithField("file", file).
-				Fatal("unable to seek to last megabyte of file")
+				Fatal("unable to stat file")
+		}
+		// If we're bigger than 2m, zoom to the end of the file and go back 1mb
+		// 2m is an arbitrary limit
+		if info.Size() > 2*1024*1024 {
+			_, err := handle.Seek(-1024*1024, io.SeekEnd)
+			if err != nil {
+				logrus.WithError(err).WithField("file", file).
+					Fatal("unable to seek to last megabyte of file")
+			}
 		}
+		reader = handle
 	}
 
 	// we use a scanner to read to the last line
 	// not the most efficient
-	scanner := bufio.NewScanner(handle)
+	scanner := bufio.NewScanner(reader)
 	var line string
 	for scanner.Scan() {
 		line = scanner.Text()
 	}
 
-	if scanner.Err() != nil {
+	if err := scanner.Err(); err != nil {
 		logrus.WithError(err).WithField("file", file).
 			Fatal("unable to read to end of file")
 	}
@@ -18,17 +18,23 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/honeycombio/honeytail/httime"
-	"github.com/honeycombio/honeytail/parsers/arangodb"
-	"github.com/honeycombio/honeytail/parsers/csv"
-	"github.com/honeycombio/honeytail/parsers/htjson"
-	"github.com/honeycombio/honeytail/parsers/keyval"
-	"github.com/honeycombio/honeytail/parsers/mongodb"
-	"github.com/honeycombio/honeytail/parsers/mysql"
-	"github.com/honeycombio/honeytail/parsers/nginx"
-	"github.com/honeycombio/honeytail/parsers/postgresql"
-	"github.com/honeycombio/honeytail/parsers/regex"
-	"github.com/honeycombio/honeytail/parsers/syslog"
+	"github.com/honeycombio/honeytail/multiline"
+	"github.com/honeycombio/honeytail/parsers"
+	"github.com/honeycombio/honeytail/receiver"
 	"github.com/honeycombio/honeytail/tail"
+
+	// the parsers register themselves with the parsers package
+	_ "github.com/honeycombio/honeytail/parsers/arangodb"
+	_ "github.com/honeycombio/honeytail/parsers/auto"
+	_ "github.com/honeycombio/honeytail/parsers/csv"
+	_ "github.com/honeycombio/honeytail/parsers/htjson"
+	_ "github.com/honeycombio/honeytail/parsers/keyval"
+	_ "github.com/honeycombio/honeytail/parsers/mongodb"
+	_ "github.com/honeycombio/honeytail/parsers/mysql"
+	_ "github.com/honeycombio/honeytail/parsers/nginx"
+	_ "github.com/honeycombio/honeytail/parsers/postgresql"
+	_ "github.com/honeycombio/honeytail/parsers/regex"
+	_ "github.com/honeycombio/honeytail/parsers/syslog"
 )
 
 // BuildID is set by Travis CI
@@ -37,19 +43,6 @@ var BuildID string
 // internal version identifier
 var version string
 
-var validParsers = []string{
-	"arangodb",
-	"csv",
-	"json",
-	"keyval",
-	"mongo",
-	"mysql",
-	"nginx",
-	"postgresql",
-	"regex",
-	"syslog",
-}
-
 // GlobalOptions has all the top level CLI flags that honeytail supports
 type GlobalOptions struct {
 	APIHost    string `long:"api_host" description:"Host for the Honeycomb API" default:"https://api.honeycomb.io/"`
@@ -69,6 +62,9 @@ type GlobalOptions struct {
 	Backfill         bool `long:"backfill" description:"Configure honeytail to ingest old data in order to backfill Honeycomb. Sets the correct values for --backoff, --tail.read_from, and --tail.stop" yaml:"backfill,omitempty"`
 	RebaseTime       bool `long:"rebase_time" description:"When backfilling data, rebase timestamps relative to the current time." yaml:"rebase_time,omitempty"`
 
+	BackfillStart string `long:"backfill_start" description:"Only send events at or after this time, eg. 2006-01-02T15:04:05Z. Each file is binary searched for the first line at or after this time using the parser's timestamps, and read from there, so lines need to be in time order. Times without a time zone are in the --timezone. Not supported for compressed files, which are read from the start." yaml:"backfill_start,omitempty"`
+	BackfillEnd   string `long:"backfill_end" description:"Stop reading each file at its first event at or after this time, eg. 2006-01-02T15:04:05Z. Must be in the past." yaml:"backfill_end,omitempty"`
+
 	Localtime           bool     `long:"localtime" description:"When parsing a timestamp that has no time zone, assume it is in the same timezone as localhost instead of UTC (the default)" yaml:"localtime,omitempty"`
 	Timezone            string   `long:"timezone" description:"When parsing a timestamp use this time zone instead of UTC (the default). Must be specified in TZ format as seen here: https://en.wikipedia.org/wiki/List_of_tz_database_time_zones" yaml:"timezone,omitempty"`
 	ScrubFields         []string `long:"scrub_field" description:"For the field listed, apply a one-way hash to the field content. May have multiple values." yaml:"scrub_field,omitempty"`
@@ -91,24 +87,102 @@ type GlobalOptions struct {
 	JSONFields          []string `long:"json_field" description:"JSON fields encoded as string to unescape and properly parse before sending. May have multiple values." yaml:"json_field,omitempty"`
 	FilterFiles         []string `short:"F" long:"filter-file" description:"Log file(s) to exclude from --file glob. May have multiple values, including multiple globs." yaml:"filter-file,omitempty"`
 	RenameFields        []string `long:"rename_field" description:"Format: 'before=after'. Rename field called 'before' from parsed lines to field name 'after' in Honeycomb events. May have multiple values." yaml:"rename_field,omitempty"`
+	UnparsedOutput      string   `long:"unparsed_output" description:"Where to put the lines that fail to parse, along with the file and offset they came from, the parser and its error. A path appends them to that file as newline delimited JSON. dataset:NAME sends them as events to the dataset NAME instead. Either way, --drop_field, --redact and --scrub_field apply to them as they do to events, and how many lines each parser fails to parse is in the summary of sent events." yaml:"unparsed_output,omitempty"`
+	Subparse            []string `long:"subparse" description:"Format: 'field=parser' or 'field=parser:prefix'. Parse the string in field with the line parser of parser, one of json, keyval, regex, csv or syslog, and add the fields found to the event, named prefix_name with a prefix to keep them from colliding with the event's fields. The parser takes its usual options, eg. --regex.line_regex. May have multiple values." yaml:"subparse,omitempty"`
+	SubparseTimestamp   bool     `long:"subparse_timestamp" description:"Use a timestamp found by subparse as the time of the event, in place of the one from the parser. The timestamp is found with the subparse parser's time field and format options, eg. --json.timefield" yaml:"subparse_timestamp,omitempty"`
+	FieldTypes          []string `long:"field_type" description:"Format: 'field=type'. Convert the value of field to type, one of int, float, bool, string, duration (eg. 1.5s, converted to milliseconds), bytes (eg. 10KB or 1.5MiB, converted to bytes) or timestamp. Values that fail to convert are left as they are and counted in the summary of sent events. May have multiple values." yaml:"field_type,omitempty"`
+	NoTypeInference     bool     `long:"no_type_inference" description:"Keep the values found by parsers that guess at types (csv, keyval and nginx), and the numbers in json, as strings, so only the fields in --field_type are converted. Big numbers like IDs then keep all their digits" yaml:"no_type_inference,omitempty"`
+	Filter              string   `long:"filter" description:"Only send the events matching this expression, eg. 'status >= 500 || path =~ \"^/api\"'. Fields are compared with ==, !=, <, <=, > and >=, matched against regexes with =~ and !~, and checked for with just their name, and these are combined with &&, || and !. Comparisons with a field the event doesn't have are false." yaml:"filter,omitempty"`
+	InvertFilter        bool     `long:"invert_filter" description:"Drop the events matching --filter instead of sending only them" yaml:"invert_filter,omitempty"`
+	Redact              []string `long:"redact" description:"Replace the parts of string fields that look like sensitive data with [REDACTED:name], leaving the rest of the text. Detectors: email, pan (card numbers, checked with the Luhn algorithm), ipv4, ipv6, jwt, aws_key (access key IDs, and secret keys next to a name saying so) and bearer (the token after Bearer), or your own as name=regex. If the regex has a group, only what the group matches is replaced. How many values each detector replaced is in the summary of sent events. May have multiple values." yaml:"redact,omitempty"`
+	RedactFields        []string `long:"redact_field" description:"Only redact the values of this field. A field inside an object, or inside each object of a list, is named with dots, eg. user.email. Defaults to all string fields, and the strings in the objects and lists of the others. May have multiple values." yaml:"redact_field,omitempty"`
+	RedactHashKey       string   `long:"redact_hash_key" description:"Replace redacted values with [REDACTED:name:hash] instead, the hash being an HMAC-SHA256 of the value keyed with this. The same value gets the same hash, so it can still be counted or grouped by without being sent." yaml:"redact_hash_key,omitempty"`
+
+	Input  string `long:"input" description:"Where to read log lines from. Values: file, syslog, http. File reads the --file paths. Syslog listens on --listen for syslog messages over both UDP and TCP, framed by newlines or octet counting, and adds the address they came from as the sender_address field. Syslog requires --parser=syslog. Http runs a server on --listen that takes newline delimited lines POSTed to the --http.route paths." default:"file" yaml:"input,omitempty"`
+	Listen string `long:"listen" description:"Address to listen on when --input isn't file, eg. :514" yaml:"listen,omitempty"`
+
+	Name       string      `long:"name" description:"Name of the pipeline, to tell pipelines apart in the summary of sent events. Mostly useful in the pipelines listed in --config_yaml." yaml:"name,omitempty"`
+	Transforms []yaml.Node `no-flag:"true" description:"Only in --config_yaml, the steps that munge the events, run in the order they're listed. Each step has a type, one of subparse, field_type, filter, request_shape, da_map_file, drop_field, redact, scrub_field, add_field, sample, rebase_time, json_field or rename_field, and the options of that flag to run it with, eg. {type: rename_field, rename_field: [a=b]}. Steps use the rest of the config's options for the ones they don't set. When listed, only the listed steps run, and sampling is done last unless it's one of them. Without a list, the steps run in that order, doing what the flags ask for." yaml:"transforms,omitempty"`
+	Pipelines  []yaml.Node `no-flag:"true" description:"Only in --config_yaml, a list of pipelines to run in this honeytail, each with its own files, parser, options and dataset. Each pipeline is shaped like the top level of the YAML config, and its settings apply on top of the top level ones. Pipelines sending to the same write key and dataset share a connection to Honeycomb, which uses the batching settings of the first of them. A file can only be read by one pipeline." yaml:"pipelines,omitempty"`
 
 	LogLevel string `long:"log_level" description:"Set the log level. Valid values are 'debug', 'info', 'warn', 'error', 'fatal', 'panic'." default:"info" yaml:"log_level,omitempty"`
 
 	Reqs  RequiredOptions `group:"Required Options" yaml:"required_options,omitempty"`
 	Modes OtherModes      `group:"Other Modes" yaml:"-"`
 
-	Tail tail.TailOptions `group:"Tail Options" namespace:"tail" yaml:",omitempty"`
-
-	ArangoDB   arangodb.Options   `group:"ArangoDB Parser Options" namespace:"arangodb" yaml:",omitempty"`
-	CSV        csv.Options        `group:"CSV Parser Options" namespace:"csv" yaml:",omitempty"`
-	JSON       htjson.Options     `group:"JSON Parser Options" namespace:"json" yaml:",omitempty"`
-	KeyVal     keyval.Options     `group:"KeyVal Parser Options" namespace:"keyval" yaml:",omitempty"`
-	Mongo      mongodb.Options    `group:"MongoDB Parser Options" namespace:"mongo" yaml:",omitempty"`
-	MySQL      mysql.Options      `group:"MySQL Parser Options" namespace:"mysql" yaml:",omitempty"`
-	Nginx      nginx.Options      `group:"Nginx Parser Options" namespace:"nginx" yaml:",omitempty"`
-	PostgreSQL postgresql.Options `group:"PostgreSQL Parser Options" namespace:"postgresql" yaml:",omitempty"`
-	Regex      regex.Options      `group:"Regex Parser Options" namespace:"regex" yaml:",omitempty"`
-	Syslog     syslog.Options     `group:"Syslog Parser Options" namespace:"syslog" yaml:",omitempty"`
+	Tail      tail.TailOptions     `group:"Tail Options" namespace:"tail" yaml:",omitempty"`
+	Multiline multiline.Options    `group:"Multiline Options" namespace:"multiline" yaml:",omitempty"`
+	HTTP      receiver.HTTPOptions `group:"HTTP Input Options" namespace:"http" yaml:",omitempty"`
+
+	// Parsers has a pointer to the options of each registered parser by its
+	// name. Their flags are added to the flag parser by addParserOptions, and
+	// each has its own section in the YAML config.
+	Parsers map[string]interface{} `no-flag:"true" yaml:"-"`
+}
+
+// addParserOptions adds a group of flags for the options of each registered
+// parser to fp, namespaced by the parser's name
+func addParserOptions(fp *flag.Parser, options *GlobalOptions) {
+	options.Parsers = make(map[string]interface{})
+	for _, r := range parsers.Registered() {
+		opts := r.NewOptions()
+		group, err := fp.AddGroup(r.Title+" Parser Options", "", opts)
+		if err != nil {
+			// only happens when the options aren't a struct
+			panic(err)
+		}
+		group.Namespace = r.Name
+		options.Parsers[r.Name] = opts
+	}
+}
+
+// UnmarshalYAML reads the options of each registered parser from the section
+// named after it, along with the rest of the options. The parser options are
+// copied first so that options copied from these, like the pipelines, don't
+// share them.
+func (o *GlobalOptions) UnmarshalYAML(value *yaml.Node) error {
+	type plain GlobalOptions
+	if err := value.Decode((*plain)(o)); err != nil {
+		return err
+	}
+	sections := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		sections[value.Content[i].Value] = value.Content[i+1]
+	}
+	parserOptions := make(map[string]interface{})
+	for _, r := range parsers.Registered() {
+		opts := r.CopyOptions(o.Parsers[r.Name])
+		if section, ok := sections[r.Name]; ok {
+			if err := section.Decode(opts); err != nil {
+				return err
+			}
+		}
+		parserOptions[r.Name] = opts
+	}
+	o.Parsers = parserOptions
+	return nil
+}
+
+// MarshalYAML writes the options of each registered parser that has any set
+// to the section named after it, after the rest of the options.
+func (o GlobalOptions) MarshalYAML() (interface{}, error) {
+	type plain GlobalOptions
+	var node yaml.Node
+	if err := node.Encode(plain(o)); err != nil {
+		return nil, err
+	}
+	for _, r := range parsers.Registered() {
+		opts, ok := o.Parsers[r.Name]
+		if !ok || opts == nil || reflect.ValueOf(opts).Elem().IsZero() {
+			continue
+		}
+		var section yaml.Node
+		if err := section.Encode(opts); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: r.Name}, &section)
+	}
+	return &node, nil
 }
 
 type RequiredOptions struct {
@@ -132,6 +206,7 @@ type OtherModes struct {
 func main() {
 	var options GlobalOptions
 	flagParser := flag.NewParser(&options, flag.PrintErrors)
+	addParserOptions(flagParser, &options)
 	flagParser.Usage = `-p <parser> -k <writekey> -f </path/to/logfile> -d <mydata> [optional arguments]
 
 See https://honeycomb.io/docs/connect/agent/ for more detailed usage instructions.`
@@ -185,12 +260,7 @@ See https://honeycomb.io/docs/connect/agent/ for more detailed usage instruction
 		logrus.SetLevel(level)
 	}
 
-	// Support flag alias: --backfill should cover --backoff --tail.read_from=beginning --tail.stop
-	if options.Backfill {
-		options.BackOff = true
-		options.Tail.ReadFrom = "beginning"
-		options.Tail.Stop = true
-	}
+	setBackfillOptions(&options)
 
 	// set time zone info
 	if options.Localtime {
@@ -208,26 +278,47 @@ See https://honeycomb.io/docs/connect/agent/ for more detailed usage instruction
 		httime.Location = loc
 	}
 
-	setVersionUserAgent(options.Backfill, options.Reqs.ParserName)
 	handleOtherModes(flagParser, options)
-	addParserDefaultOptions(&options)
-	sanityCheckOptions(&options)
+	pipelines, err := getPipelines(options)
+	if err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+	backfill := false
+	parserNames := make([]string, 0, len(pipelines))
+	for i := range pipelines {
+		addParserDefaultOptions(&pipelines[i])
+		sanityCheckOptions(&pipelines[i])
+		backfill = backfill || pipelines[i].Backfill
+		parserNames = append(parserNames, pipelines[i].Reqs.ParserName)
+	}
+	setVersionUserAgent(backfill, strings.Join(parserNames, ","))
 
-	if !options.DebugOut {
+	verified := make(map[string]bool)
+	for _, pipeline := range pipelines {
+		if pipeline.DebugOut {
+			logrus.Debug("skipping Honeycomb write key verification, because --debug_stdout is set...")
+			continue
+		}
+		if verified[pipeline.Reqs.WriteKey] {
+			continue
+		}
 		if _, err := libhoney.VerifyAPIKey(libhoney.Config{
-			APIHost:  options.APIHost,
-			WriteKey: options.Reqs.WriteKey,
+			APIHost:  pipeline.APIHost,
+			WriteKey: pipeline.Reqs.WriteKey,
 		}); err != nil {
 			fmt.Fprintln(os.Stderr, "Could not verify Honeycomb write key: ", err)
 			os.Exit(1)
 		}
-	} else {
-		logrus.Debug("skipping Honeycomb write key verification, because --debug_stdout is set...")
+		verified[pipeline.Reqs.WriteKey] = true
 	}
 
-	logrus.Debug("parsed arguments: ", structToString(options))
+	for _, pipeline := range pipelines {
+		logrus.Debug("parsed arguments: ", structToString(pipeline))
+	}
 
-	run(context.Background(), options, nil)
+	runPipelines(context.Background(), pipelines, nil)
 }
 
 // convert options struct to a comma separated list of key=value pairs (for debugging)
@@ -258,6 +349,79 @@ func structToString(s interface{}) string {
 	return strings.Join(fields, ",")
 }
 
+// setBackfillOptions supports the flag alias: --backfill should cover
+// --backoff --tail.read_from=beginning --tail.stop
+func setBackfillOptions(options *GlobalOptions) {
+	if options.Backfill {
+		options.BackOff = true
+		options.Tail.ReadFrom = "beginning"
+		options.Tail.Stop = true
+	}
+}
+
+// getPipelines returns the options for each of the pipelines listed in the
+// YAML config, made by applying each one's settings on top of options. Without
+// any listed, options is the only pipeline.
+func getPipelines(options GlobalOptions) ([]GlobalOptions, error) {
+	if len(options.Pipelines) == 0 {
+		return []GlobalOptions{options}, nil
+	}
+	base := options
+	base.Pipelines = nil
+	pipelines := make([]GlobalOptions, 0, len(options.Pipelines))
+	names := make(map[string]bool)
+	for i, node := range options.Pipelines {
+		pipeline := base
+		pipeline.Name = ""
+		if err := node.Decode(&pipeline); err != nil {
+			return nil, fmt.Errorf("unable to read pipeline %d in %s: %s", i+1, options.ConfigYaml, err)
+		}
+		if pipeline.Name == "" {
+			pipeline.Name = fmt.Sprintf("pipeline%d", i+1)
+		}
+		if names[pipeline.Name] {
+			return nil, fmt.Errorf("more than one pipeline is named %s", pipeline.Name)
+		}
+		names[pipeline.Name] = true
+		setBackfillOptions(&pipeline)
+		pipelines = append(pipelines, pipeline)
+	}
+	if err := checkPipelineFiles(pipelines); err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+// checkPipelineFiles makes sure no file is read by more than one pipeline, as
+// where honeytail is in a file is kept by its path
+func checkPipelineFiles(pipelines []GlobalOptions) error {
+	readBy := make(map[string]string)
+	for _, pipeline := range pipelines {
+		if pipeline.Input == "syslog" || pipeline.Input == "http" {
+			continue
+		}
+		files := make(map[string]bool)
+		for _, pattern := range pipeline.Reqs.LogFiles {
+			// the pattern itself, for files that don't exist yet
+			files[pattern] = true
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return fmt.Errorf("bad --file %s in pipeline %s: %s", pattern, pipeline.Name, err)
+			}
+			for _, match := range matches {
+				files[match] = true
+			}
+		}
+		for file := range files {
+			if other, ok := readBy[file]; ok {
+				return fmt.Errorf("pipelines %s and %s both read %s, a file can only be read by one pipeline", other, pipeline.Name, file)
+			}
+			readBy[file] = pipeline.Name
+		}
+	}
+	return nil
+}
+
 // setVersion sets the internal version ID and updates libhoney's user-agent
 func setVersionUserAgent(backfill bool, parserName string) {
 	if BuildID == "" {
@@ -309,7 +473,11 @@ func handleOtherModes(fp *flag.Parser, options GlobalOptions) {
 	}
 
 	if modes.ListParsers {
-		fmt.Println("Available parsers:", strings.Join(validParsers, ", "))
+		var names []string
+		for _, r := range parsers.Registered() {
+			names = append(names, r.Name)
+		}
+		fmt.Println("Available parsers:", strings.Join(names, ", "))
 		os.Exit(0)
 	}
 }
@@ -346,11 +514,39 @@ func sanityCheckOptions(options *GlobalOptions) {
 		fmt.Println("Parser required to be specified with the --parser flag.")
 		usage()
 		os.Exit(1)
+	case parsers.Lookup(options.Reqs.ParserName) == nil:
+		fmt.Printf("Unknown parser %s. Use --list to list available parsers.\n", options.Reqs.ParserName)
+		usage()
+		os.Exit(1)
 	case (options.Reqs.WriteKey == "" || options.Reqs.WriteKey == "NULL") && (!options.DebugOut):
 		fmt.Println("Write key required to be specified with the --writekey flag.")
 		usage()
 		os.Exit(1)
-	case len(options.Reqs.LogFiles) == 0:
+	case options.Input != "file" && options.Input != "syslog" && options.Input != "http":
+		fmt.Printf("Unknown --input %s. Values: file, syslog, http.\n", options.Input)
+		usage()
+		os.Exit(1)
+	case options.UnparsedOutput == unparsedDatasetPrefix:
+		fmt.Println("--unparsed_output=dataset: needs the name of the dataset, eg. dataset:unparsed.")
+		usage()
+		os.Exit(1)
+	case options.Input == "syslog" && options.Reqs.ParserName != "syslog":
+		fmt.Println("--input=syslog requires --parser=syslog.")
+		usage()
+		os.Exit(1)
+	case options.Input != "file" && options.Listen == "":
+		fmt.Printf("An address to listen on is required with --input=%s. Use the --listen flag.\n", options.Input)
+		usage()
+		os.Exit(1)
+	case options.Input != "file" && options.Multiline.Enabled():
+		fmt.Println("The multiline options can only be used with --input=file.")
+		usage()
+		os.Exit(1)
+	case options.Input != "file" && (options.BackfillStart != "" || options.BackfillEnd != ""):
+		fmt.Println("--backfill_start and --backfill_end can only be used with --input=file.")
+		usage()
+		os.Exit(1)
+	case options.Input == "file" && len(options.Reqs.LogFiles) == 0:
 		fmt.Println("Log file name or '-' required to be specified with the --file flag.")
 		usage()
 		os.Exit(1)
@@ -388,6 +584,32 @@ func sanityCheckOptions(options *GlobalOptions) {
 		os.Exit(1)
 	}
 
+	if _, err := tail.ParseRotateStyle(options.Tail.RotateStyle); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+	if _, err := tail.ParseFormat(options.Tail.Format); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+	if _, err := tail.ParseEncoding(options.Tail.Encoding); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+	if _, err := tail.ParseLongLineAction(options.Tail.LongLines); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+	if options.Tail.MaxLineBytes < 0 {
+		fmt.Println("--tail.max_line_bytes must not be negative")
+		usage()
+		os.Exit(1)
+	}
+
 	// check the prefix regex for validity
 	if options.PrefixRegex != "" {
 		// make sure the regex is anchored against the start of the string
@@ -403,12 +625,53 @@ func sanityCheckOptions(options *GlobalOptions) {
 		}
 	}
 
+	// check the transforms of the YAML config
+	if _, err := getTransformSteps(*options); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+
+	// check the backfill time window
+	if _, err := newTimeWindow(*options); err != nil {
+		fmt.Println(err)
+		usage()
+		os.Exit(1)
+	}
+
+	// check the HTTP routes
+	for _, route := range options.HTTP.Routes {
+		if _, err := receiver.ParseRoute(route); err != nil {
+			fmt.Println(err)
+			usage()
+			os.Exit(1)
+		}
+	}
+
+	// check the multiline options
+	if options.Multiline.Enabled() {
+		if options.Reqs.ParserName == "mysql" || options.Reqs.ParserName == "postgresql" {
+			fmt.Printf("The %s parser groups lines into events itself and can't be used with the multiline options.\n", options.Reqs.ParserName)
+			usage()
+			os.Exit(1)
+		}
+		if _, err := multiline.New(options.Multiline); err != nil {
+			fmt.Println(err)
+			usage()
+			os.Exit(1)
+		}
+	}
+
 	// Make sure input files exist
 	shouldExit := false
 	for _, f := range options.Reqs.LogFiles {
 		if f == "-" {
 			continue
 		}
+		if options.Tail.DiscoverFiles && !options.Tail.Stop {
+			// files may show up later
+			continue
+		}
 		if files, err := filepath.Glob(f); err != nil || files == nil {
 			fmt.Printf("Log file specified by --file=%s not found!\n", f)
 			shouldExit = true
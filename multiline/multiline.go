@@ -0,0 +1,128 @@
+// Package multiline groups the lines of a log event that spans several lines,
+// like a stack trace, into one line before it gets to the parser.
+package multiline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+type Options struct {
+	StartPattern    string `long:"start_pattern" description:"Regex matching the first line of each event. Lines that don't match are added to the event before them, joined by newlines." yaml:"start_pattern,omitempty"`
+	ContinuePattern string `long:"continue_pattern" description:"Regex matching the lines that continue the event before them, like the indented lines of a stack trace. Lines that don't match start a new event. Can't be used with --multiline.start_pattern." yaml:"continue_pattern,omitempty"`
+	MaxLines        uint   `long:"max_lines" description:"Maximum number of lines in one event. Longer events are split. 0 means no limit." default:"500" yaml:"max_lines"`
+	FlushTimeoutMs  uint   `long:"flush_timeout_ms" description:"Send an event when no line has been added to it for this many milliseconds instead of waiting for the next event to start. 0 means wait." default:"1000" yaml:"flush_timeout_ms"`
+}
+
+// Enabled returns true if lines should be grouped
+func (o Options) Enabled() bool {
+	return o.StartPattern != "" || o.ContinuePattern != ""
+}
+
+// Grouper groups lines according to its Options. One Grouper can group lines
+// from any number of files.
+type Grouper struct {
+	start        *regexp.Regexp
+	cont         *regexp.Regexp
+	maxLines     int
+	flushTimeout time.Duration
+}
+
+// New validates the options and compiles their patterns
+func New(options Options) (*Grouper, error) {
+	if options.StartPattern != "" && options.ContinuePattern != "" {
+		return nil, errors.New("only one of --multiline.start_pattern and --multiline.continue_pattern can be set")
+	}
+	g := &Grouper{
+		maxLines:     int(options.MaxLines),
+		flushTimeout: time.Duration(options.FlushTimeoutMs) * time.Millisecond,
+	}
+	var err error
+	if options.StartPattern != "" {
+		if g.start, err = regexp.Compile(options.StartPattern); err != nil {
+			return nil, fmt.Errorf("--multiline.start_pattern %s doesn't compile: %s", options.StartPattern, err)
+		}
+	}
+	if options.ContinuePattern != "" {
+		if g.cont, err = regexp.Compile(options.ContinuePattern); err != nil {
+			return nil, fmt.Errorf("--multiline.continue_pattern %s doesn't compile: %s", options.ContinuePattern, err)
+		}
+	}
+	return g, nil
+}
+
+// startsEvent returns true if text is the first line of a new event
+func (g *Grouper) startsEvent(text string) bool {
+	switch {
+	case g.start != nil:
+		return g.start.MatchString(text)
+	case g.cont != nil:
+		return !g.cont.MatchString(text)
+	}
+	return true
+}
+
+// Group reads the lines of a single file from lines and returns a channel that
+// gets one line per event, which is closed when lines is closed. The grouped
+// line has the Source and Offset of the last line in it, and the Fields and
+// Dataset of the first.
+func (g *Grouper) Group(lines chan event.Line) chan event.Line {
+	grouped := make(chan event.Line)
+	go func() {
+		defer close(grouped)
+		var pending []string
+		var first, last event.Line
+		flush := func() {
+			if len(pending) == 0 {
+				return
+			}
+			grouped <- event.Line{
+				Text:    strings.Join(pending, "\n"),
+				Source:  last.Source,
+				Offset:  last.Offset,
+				Fields:  first.Fields,
+				Dataset: first.Dataset,
+			}
+			pending = nil
+		}
+
+		// a nil channel never fires, so without a timeout events wait for
+		// the next one to start
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if g.flushTimeout > 0 {
+			timer = time.NewTimer(g.flushTimeout)
+			timer.Stop()
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					flush()
+					return
+				}
+				if g.startsEvent(line.Text) || (g.maxLines > 0 && len(pending) >= g.maxLines) {
+					flush()
+				}
+				if len(pending) == 0 {
+					first = line
+				}
+				pending = append(pending, line.Text)
+				last = line
+				if timer != nil {
+					timer.Reset(g.flushTimeout)
+				}
+			case <-timeout:
+				flush()
+			}
+		}
+	}()
+	return grouped
+}
@@ -0,0 +1,142 @@
+package multiline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const stackTrace = `2024-01-02 03:04:05 ERROR something broke
+java.lang.IllegalStateException: oops
+	at com.example.Foo.bar(Foo.java:10)
+	at com.example.Main.main(Main.java:3)
+2024-01-02 03:04:06 INFO all better`
+
+// group sends each line of text through a Grouper and collects what comes out
+func group(t *testing.T, options Options, texts []string) []event.Line {
+	g, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan event.Line)
+	grouped := g.Group(lines)
+	go func() {
+		for i, text := range texts {
+			lines <- event.Line{Text: text, Source: "app.log", Offset: int64(i + 1)}
+		}
+		close(lines)
+	}()
+	var out []event.Line
+	for line := range grouped {
+		out = append(out, line)
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{StartPattern: "^a", ContinuePattern: "^b"})
+	assert.Error(t, err)
+	_, err = New(Options{StartPattern: "("})
+	assert.Error(t, err)
+	_, err = New(Options{ContinuePattern: "("})
+	assert.Error(t, err)
+	assert.False(t, Options{MaxLines: 10}.Enabled())
+	assert.True(t, Options{ContinuePattern: `^\s`}.Enabled())
+}
+
+func TestGroup(t *testing.T) {
+	texts := []string{
+		"2024-01-02 03:04:05 ERROR something broke",
+		"java.lang.IllegalStateException: oops",
+		"\tat com.example.Foo.bar(Foo.java:10)",
+		"\tat com.example.Main.main(Main.java:3)",
+		"2024-01-02 03:04:06 INFO all better",
+	}
+	expected := []event.Line{
+		{Text: stackTrace[:len(stackTrace)-len(texts[4])-1], Source: "app.log", Offset: 4},
+		{Text: texts[4], Source: "app.log", Offset: 5},
+	}
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"start pattern", Options{StartPattern: `^\d{4}-\d{2}-\d{2} `}},
+		{"continue pattern", Options{ContinuePattern: `^(\s|java\.)`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, expected, group(t, tt.options, texts))
+		})
+	}
+}
+
+func TestGroupMaxLines(t *testing.T) {
+	out := group(t, Options{StartPattern: "^start", MaxLines: 2},
+		[]string{"start", "one", "two", "three", "start"})
+	assert.Equal(t, []event.Line{
+		{Text: "start\none", Source: "app.log", Offset: 2},
+		{Text: "two\nthree", Source: "app.log", Offset: 4},
+		{Text: "start", Source: "app.log", Offset: 5},
+	}, out)
+}
+
+func TestGroupFieldsAndDataset(t *testing.T) {
+	g, err := New(Options{StartPattern: "^start"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan event.Line)
+	grouped := g.Group(lines)
+	go func() {
+		lines <- event.Line{Text: "start", Fields: map[string]interface{}{"sender_address": "10.0.0.1"}, Dataset: "app"}
+		lines <- event.Line{Text: "more", Fields: map[string]interface{}{"sender_address": "10.0.0.2"}, Dataset: "jobs"}
+		lines <- event.Line{Text: "start"}
+		close(lines)
+	}()
+	// the event gets them from its first line
+	line := <-grouped
+	assert.Equal(t, "start\nmore", line.Text)
+	assert.Equal(t, map[string]interface{}{"sender_address": "10.0.0.1"}, line.Fields)
+	assert.Equal(t, "app", line.Dataset)
+	line = <-grouped
+	assert.Nil(t, line.Fields)
+	assert.Empty(t, line.Dataset)
+}
+
+func TestGroupFlushTimeout(t *testing.T) {
+	g, err := New(Options{StartPattern: "^start", FlushTimeoutMs: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan event.Line)
+	defer close(lines)
+	grouped := g.Group(lines)
+	lines <- event.Line{Text: "start"}
+	lines <- event.Line{Text: "more"}
+	select {
+	case line := <-grouped:
+		assert.Equal(t, "start\nmore", line.Text)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the event to be flushed")
+	}
+
+	// without a timeout the event waits for the next one
+	g, err = New(Options{StartPattern: "^start"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan event.Line)
+	defer close(waiting)
+	grouped = g.Group(waiting)
+	waiting <- event.Line{Text: "start"}
+	select {
+	case line := <-grouped:
+		t.Fatalf("unexpected event %q", line.Text)
+	case <-time.After(50 * time.Millisecond):
+	}
+	waiting <- event.Line{Text: "start"}
+	assert.Equal(t, "start", (<-grouped).Text)
+}
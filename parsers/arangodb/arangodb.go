@@ -42,13 +42,24 @@ var timestampFormats = []string{
 
 // Options type for line parser, so far there are none.
 type Options struct {
-	numParsers int
+	NumParsers int `hidden:"true" description:"number of arangodb parsers to spin up" yaml:"-"`
+}
+
+func init() {
+	parsers.Register("arangodb", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		if settings.Ordered {
+			// otherwise it uses its own default
+			options.(*Options).NumParsers = settings.NumParsers
+		}
+		return &Parser{unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("ArangoDB"))
 }
 
 // Parser for log lines.
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	unparsed   parsers.UnparsedFunc
 }
 
 // ArangoLineParser is a LineParser for ArangoDB log files.
@@ -168,17 +179,17 @@ func (p *Parser) Init(options interface{}) error {
 }
 
 // ProcessLines method for Parser.
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	wg := sync.WaitGroup{}
 	numParsers := defaultNumParsers
-	if p.conf.numParsers > 0 {
-		numParsers = p.conf.numParsers
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
 	}
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for rawLine := range lines {
+				line := strings.TrimSpace(rawLine.Text)
 				// take care of any headers on the line
 				var prefixFields map[string]string
 				if prefixRegex != nil {
@@ -192,7 +203,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				if err == nil {
 					timestamp, err := p.parseTimestamp(values)
 					if err != nil {
-						logSkipped(line, "couldn't parse logline timestamp, skipping")
+						p.logSkipped(rawLine, line, err, "couldn't parse logline timestamp, skipping")
 						continue
 					}
 
@@ -200,6 +211,10 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					for k, v := range prefixFields {
 						values[k] = v
 					}
+					// and anything known about where the line came from
+					for k, v := range rawLine.Fields {
+						values[k] = v
+					}
 
 					logrus.WithFields(logrus.Fields{
 						"line":   line,
@@ -213,9 +228,12 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					send <- event.Event{
 						Timestamp: timestamp,
 						Data:      values,
+						Source:    rawLine.Source,
+						Offset:    rawLine.Offset,
+						Dataset:   rawLine.Dataset,
 					}
 				} else {
-					logSkipped(line, "logline didn't parse, skipping.")
+					p.logSkipped(rawLine, line, err, "logline didn't parse, skipping.")
 				}
 			}
 			wg.Done()
@@ -242,6 +260,8 @@ func (p *Parser) parseTimestamp(values map[string]interface{}) (time.Time, error
 	return time.Time{}, errors.New("timestamp missing from logline")
 }
 
-func logSkipped(line string, msg string) {
+// logSkipped logs why a line was skipped and reports it as unparsed
+func (p *Parser) logSkipped(rawLine event.Line, line string, err error, msg string) {
 	logrus.WithFields(logrus.Fields{"line": line}).Debugln(msg)
+	p.unparsed.Report(rawLine, err)
 }
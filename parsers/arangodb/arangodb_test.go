@@ -68,15 +68,15 @@ func TestProcessLines(t *testing.T) {
 		},
 	}
 	m := &Parser{
-		conf:       Options{numParsers: 1},
+		conf:       Options{NumParsers: 1},
 		lineParser: &ArangoLineParser{},
 	}
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	// prep the incoming channel with test lines for the processor
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
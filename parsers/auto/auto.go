@@ -0,0 +1,298 @@
+// Package auto picks the parser for each file by trying the parsers of the
+// common log formats on the file's first lines
+package auto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+	"github.com/honeycombio/honeytail/parsers/htjson"
+	"github.com/honeycombio/honeytail/parsers/keyval"
+	"github.com/honeycombio/honeytail/parsers/mongodb"
+	"github.com/honeycombio/honeytail/parsers/nginx"
+	"github.com/honeycombio/honeytail/parsers/syslog"
+)
+
+const (
+	defaultSampleLines  = 100
+	defaultMinParseRate = 0.9
+	// sampleWait is how long to wait for the next line once a file has some,
+	// so a short file that's still being written doesn't hold up its parsing
+	sampleWait = 5 * time.Second
+)
+
+// Options defines the options relevant to the auto parser
+type Options struct {
+	SampleLines  int     `long:"sample_lines" description:"Number of lines at the start of each file to pick the parser with (default 100)" yaml:"sample_lines,omitempty"`
+	MinParseRate float64 `long:"min_parse_rate" description:"Fraction of the sampled lines the picked parser has to parse, from 0 to 1 (default 0.9)" yaml:"min_parse_rate,omitempty"`
+}
+
+func init() {
+	parsers.Register("auto", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		return &Parser{settings: settings}
+	}, Options{}, parsers.WithTitle("Auto"))
+}
+
+// Parser samples the first lines of a file, picks the format that parses
+// the most of them, and hands the file to that format's parser
+type Parser struct {
+	conf     Options
+	settings parsers.Settings
+}
+
+// candidate is a log format the parser can pick
+type candidate struct {
+	// name describes the format, eg. "syslog rfc5424"
+	name string
+	// parser is the name the format's parser is registered with, and options
+	// are the parser's options for the format
+	parser     string
+	options    interface{}
+	lineParser parsers.LineParser
+	// hasTimestamp is whether the parser will find the time of a parsed line
+	hasTimestamp func(map[string]interface{}) bool
+}
+
+// result is how well a candidate fits the sampled lines
+type result struct {
+	candidate
+	// parseRate is the fraction of the sampled lines the candidate parses
+	parseRate float64
+	// timestampRate is the fraction of the parsed lines that have a time
+	timestampRate float64
+}
+
+// candidates returns the formats to try, the ones to prefer when several
+// parse the lines equally well first
+func candidates() []candidate {
+	cs := []candidate{
+		{
+			name:         "json",
+			parser:       "json",
+			options:      &htjson.Options{},
+			lineParser:   &htjson.JSONLineParser{},
+			hasTimestamp: httime.HasTimestamp,
+		},
+	}
+	for _, mode := range []string{"rfc5424", "rfc3164"} {
+		lineParser, _ := syslog.NewSyslogLineParser(mode, "")
+		cs = append(cs, candidate{
+			name:       "syslog " + mode,
+			parser:     "syslog",
+			options:    &syslog.Options{Mode: mode},
+			lineParser: lineParser,
+			hasTimestamp: func(m map[string]interface{}) bool {
+				ts, ok := m["timestamp"].(time.Time)
+				return ok && !ts.IsZero()
+			},
+		})
+	}
+	for _, format := range nginx.KnownFormats {
+		cs = append(cs, candidate{
+			name:         "nginx " + format.Name,
+			parser:       "nginx",
+			options:      &nginx.Options{LogFormat: format.Format},
+			lineParser:   nginx.NewGonxLineParser(format.Format),
+			hasTimestamp: hasString("time_local"),
+		})
+	}
+	return append(cs,
+		candidate{
+			name:         "mongo",
+			parser:       "mongo",
+			options:      &mongodb.Options{},
+			lineParser:   &mongodb.MongoLineParser{},
+			hasTimestamp: hasString("timestamp"),
+		},
+		// key=value pairs are found in most lines, so it comes last
+		candidate{
+			name:         "keyval",
+			parser:       "keyval",
+			options:      &keyval.Options{},
+			lineParser:   &keyval.KeyValLineParser{},
+			hasTimestamp: httime.HasTimestamp,
+		},
+	)
+}
+
+// hasString returns a hasTimestamp for formats that always put the time in
+// field
+func hasString(field string) func(map[string]interface{}) bool {
+	return func(m map[string]interface{}) bool {
+		s, ok := m[field].(string)
+		return ok && s != ""
+	}
+}
+
+// Init constructs our parser from the provided options
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	if p.conf.SampleLines == 0 {
+		p.conf.SampleLines = defaultSampleLines
+	}
+	if p.conf.MinParseRate == 0 {
+		p.conf.MinParseRate = defaultMinParseRate
+	}
+	if p.conf.SampleLines < 0 {
+		return fmt.Errorf("--auto.sample_lines must be positive, got %d", p.conf.SampleLines)
+	}
+	if p.conf.MinParseRate < 0 || p.conf.MinParseRate > 1 {
+		return fmt.Errorf("--auto.min_parse_rate must be between 0 and 1, got %v", p.conf.MinParseRate)
+	}
+	return nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	sampled := p.sample(lines)
+	var texts []string
+	for _, line := range sampled {
+		if text := strings.TrimSpace(line.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		// the lines ran out before there was anything to pick with
+		logrus.Debug("lines channel is closed, ending auto processor")
+		return
+	}
+
+	results := detect(texts, prefixRegex)
+	best := results[0]
+	fields := logrus.Fields{
+		"file":          sampled[0].Source,
+		"sampled_lines": len(texts),
+	}
+	if best.parseRate < p.conf.MinParseRate {
+		var tried []string
+		for _, r := range results {
+			tried = append(tried, fmt.Sprintf("%s %.0f%%", r.name, 100*r.parseRate))
+		}
+		fields["parsed"] = strings.Join(tried, ", ")
+		logrus.WithFields(fields).Error(
+			"No parser fits the lines of the file well enough for --parser=auto, so none of it will be parsed. Pick one with --parser, see --list")
+		p.unparsed(sampled, lines, errors.New("no parser fits the lines of the file"))
+		return
+	}
+	fields["format"] = best.name
+	fields["parser"] = best.parser
+	fields["confidence"] = fmt.Sprintf("%.0f%%", 100*best.parseRate)
+	fields["timestamps"] = fmt.Sprintf("%.0f%%", 100*best.timestampRate)
+	if best.timestampRate == 0 {
+		logrus.WithFields(fields).Warn(
+			"Picked a parser for the file, but found no timestamps in its lines so events will get the current time")
+	} else {
+		logrus.WithFields(fields).Info("Picked a parser for the file")
+	}
+
+	parser, options := parsers.Lookup(best.parser).New(best.options, p.settings)
+	if err := parser.Init(options); err != nil {
+		logrus.WithFields(fields).WithError(err).Error(
+			"Unable to initialize the parser picked by --parser=auto, so none of the file will be parsed")
+		p.unparsed(sampled, lines, err)
+		return
+	}
+	// hand the picked parser the sampled lines first, then the rest
+	replayed := make(chan event.Line)
+	go func() {
+		defer close(replayed)
+		for _, line := range sampled {
+			replayed <- line
+		}
+		for line := range lines {
+			replayed <- line
+		}
+	}()
+	parser.ProcessLines(replayed, send, prefixRegex)
+}
+
+// unparsed reports the sampled lines and the rest of lines as unparsed, for
+// files there's no parser for
+func (p *Parser) unparsed(sampled []event.Line, lines <-chan event.Line, err error) {
+	for _, line := range sampled {
+		p.settings.Unparsed.Report(line, err)
+	}
+	for line := range lines {
+		p.settings.Unparsed.Report(line, err)
+	}
+}
+
+// sample reads up to --auto.sample_lines non-blank lines. It stops early when
+// lines is closed, or when no line comes for a while after the first one.
+func (p *Parser) sample(lines <-chan event.Line) []event.Line {
+	var sampled []event.Line
+	for n := 0; n < p.conf.SampleLines; {
+		var line event.Line
+		var ok bool
+		if n == 0 {
+			line, ok = <-lines
+		} else {
+			select {
+			case line, ok = <-lines:
+			case <-time.After(sampleWait):
+				return sampled
+			}
+		}
+		if !ok {
+			return sampled
+		}
+		sampled = append(sampled, line)
+		if strings.TrimSpace(line.Text) != "" {
+			n++
+		}
+	}
+	return sampled
+}
+
+// detect tries every candidate on lines, and returns how well each did, the
+// best fit first
+func detect(lines []string, prefixRegex *parsers.ExtRegexp) []result {
+	var results []result
+	for _, c := range candidates() {
+		var parsed, stamped int
+		for _, line := range lines {
+			if prefixRegex != nil {
+				prefix, _ := prefixRegex.FindStringSubmatchMap(line)
+				line = strings.TrimPrefix(line, prefix)
+			}
+			values, err := c.lineParser.ParseLine(line)
+			if err != nil || !hasValues(values) {
+				continue
+			}
+			parsed++
+			if c.hasTimestamp(values) {
+				stamped++
+			}
+		}
+		r := result{candidate: c, parseRate: float64(parsed) / float64(len(lines))}
+		if parsed > 0 {
+			r.timestampRate = float64(stamped) / float64(parsed)
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].parseRate != results[j].parseRate {
+			return results[i].parseRate > results[j].parseRate
+		}
+		return results[i].timestampRate > results[j].timestampRate
+	})
+	return results
+}
+
+// hasValues is whether a parsed line has anything in it, as the parsers
+// don't send events for lines without
+func hasValues(values map[string]interface{}) bool {
+	for _, v := range values {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
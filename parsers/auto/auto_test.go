@@ -0,0 +1,175 @@
+package auto
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+func TestDetect(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		lines      []string
+		format     string
+		parseRate  float64
+		timestamps float64
+	}{
+		{
+			desc:       "json",
+			lines:      []string{`{"time":"2024-01-02T03:04:05Z","status":200}`, `{"time":"2024-01-02T03:04:06Z","status":500}`},
+			format:     "json",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc:      "json without timestamps, and a line that isn't json",
+			lines:     []string{`{"status":200}`, `{"status":500}`, `{"status":404}`, `oops`},
+			format:    "json",
+			parseRate: 0.75,
+		},
+		{
+			desc: "syslog rfc5424",
+			lines: []string{
+				`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`,
+				`<165>1 2003-10-11T22:14:16.003Z mymachine.example.com evntslog - ID48 - Another event`,
+			},
+			format:     "syslog rfc5424",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc: "syslog rfc3164",
+			lines: []string{
+				`<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+				`<34>Oct 11 22:14:16 mymachine sshd[123]: Accepted publickey for lonvick`,
+			},
+			format:     "syslog rfc3164",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc: "nginx combined",
+			lines: []string{
+				`10.0.0.1 - - [08/Oct/2015:00:26:26 +0000] "GET / HTTP/1.1" 200 174 "-" "curl/7.64.1"`,
+				`10.0.0.2 - frank [08/Oct/2015:00:26:27 +0000] "POST /api HTTP/1.1" 201 12 "https://example.com/" "Mozilla/5.0"`,
+			},
+			format:     "nginx combined",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc: "apache common",
+			lines: []string{
+				`10.0.0.1 - - [08/Oct/2015:00:26:26 +0000] "GET / HTTP/1.1" 200 174`,
+			},
+			format:     "nginx common",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc: "mongo",
+			lines: []string{
+				"2010-01-02T12:34:56.000Z I CONTROL [conn123456789] git version fooooooo",
+				`2016-09-14T23:36:36.793+0000 I WRITE [conn61] update protecteddb.comedy query: { name: "Hulk" } update: { $unset: { cast: 1.0 } } keysExamined:0 docsExamined:4 nMatched:0 nModified:0 keyUpdates:0 writeConflicts:0 numYields:0 0ms`,
+			},
+			format:     "mongo",
+			parseRate:  1,
+			timestamps: 1,
+		},
+		{
+			desc:       "keyval",
+			lines:      []string{`time=2024-01-02T03:04:05Z level=info msg="started"`, `time=2024-01-02T03:04:06Z level=warn msg="slow"`},
+			format:     "keyval",
+			parseRate:  1,
+			timestamps: 1,
+		},
+	}
+	for _, tc := range testCases {
+		results := detect(tc.lines, nil)
+		assert.Equal(t, tc.format, results[0].name, tc.desc)
+		assert.Equal(t, tc.parseRate, results[0].parseRate, tc.desc)
+		assert.Equal(t, tc.timestamps, results[0].timestampRate, tc.desc)
+	}
+}
+
+func TestDetectNothingFits(t *testing.T) {
+	results := detect([]string{"just some words", "and some more"}, nil)
+	for _, r := range results {
+		assert.Zero(t, r.parseRate, r.name)
+	}
+}
+
+func TestDetectPrefix(t *testing.T) {
+	prefixRegex := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^\S+ \S+ `)}
+	results := detect([]string{`host1 app: {"a":1}`, `host2 app: {"a":2}`}, prefixRegex)
+	assert.Equal(t, "json", results[0].name)
+	assert.Equal(t, 1.0, results[0].parseRate)
+}
+
+func TestInit(t *testing.T) {
+	p := &Parser{}
+	assert.Nil(t, p.Init(&Options{}))
+	assert.Equal(t, Options{SampleLines: defaultSampleLines, MinParseRate: defaultMinParseRate}, p.conf)
+	assert.NotNil(t, p.Init(&Options{MinParseRate: 2}))
+	assert.NotNil(t, p.Init(&Options{SampleLines: -1}))
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{settings: parsers.Settings{NumParsers: 1}}
+	assert.Nil(t, p.Init(&Options{SampleLines: 2}))
+	lines := make(chan event.Line)
+	send := make(chan event.Event)
+	go func() {
+		for _, text := range []string{`{"n":1}`, ``, `{"n":2}`, `{"n":3}`} {
+			lines <- event.Line{Text: text, Source: "a.log"}
+		}
+		close(lines)
+	}()
+	go func() {
+		p.ProcessLines(lines, send, nil)
+		close(send)
+	}()
+	var got []interface{}
+	for ev := range send {
+		assert.Equal(t, "a.log", ev.Source)
+		got = append(got, ev.Data["n"])
+	}
+	// the sampled lines are parsed along with the rest
+	assert.Equal(t, []interface{}{1.0, 2.0, 3.0}, got)
+}
+
+func TestProcessLinesEmpty(t *testing.T) {
+	p := &Parser{}
+	assert.Nil(t, p.Init(&Options{}))
+	lines := make(chan event.Line)
+	close(lines)
+	p.ProcessLines(lines, make(chan event.Event), nil)
+}
+
+func TestProcessLinesNothingFits(t *testing.T) {
+	var unparsed []string
+	p := &Parser{settings: parsers.Settings{
+		NumParsers: 1,
+		Unparsed: func(line event.Line, err error) {
+			assert.NotNil(t, err)
+			unparsed = append(unparsed, line.Text)
+		},
+	}}
+	assert.Nil(t, p.Init(&Options{SampleLines: 2}))
+	lines := make(chan event.Line)
+	go func() {
+		for _, text := range []string{"just some words", "and some more", "and more"} {
+			lines <- event.Line{Text: text, Source: "a.log"}
+		}
+		close(lines)
+	}()
+	send := make(chan event.Event, 3)
+	p.ProcessLines(lines, send, nil)
+	assert.Empty(t, send)
+	// the lines go to the unparsed lines rather than stopping honeytail
+	assert.Equal(t, []string{"just some words", "and some more", "and more"}, unparsed)
+}
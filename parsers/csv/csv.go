@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -24,10 +25,26 @@ type Options struct {
 	NumParsers int `hidden:"true" description:"number of csv parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("csv", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed, keepStrings: settings.NoTypeInference}
+	}, Options{}, parsers.WithTitle("CSV"), parsers.WithLineParser(func(p parsers.Parser) parsers.LineParser {
+		return p.(*Parser).lineParser
+	}), parsers.WithLineTimer(func(p parsers.Parser) parsers.LineTimer {
+		conf := p.(*Parser).conf
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			return httime.FindTimestamp(parsed, conf.TimeFieldName, conf.TimeFieldFormat)
+		}
+	}))
+}
+
 // Parser implements the Parser interface
 type Parser struct {
-	conf       Options
-	lineParser parsers.LineParser
+	conf        Options
+	lineParser  parsers.LineParser
+	unparsed    parsers.UnparsedFunc
+	keepStrings bool
 }
 
 // Init constructs our parser from the provided options
@@ -40,11 +57,16 @@ func (p *Parser) Init(options interface{}) error {
 	if err != nil {
 		return err
 	}
+	lineParser.KeepStrings = p.keepStrings
 	p.lineParser = lineParser
 	return nil
 }
 
 type CSVLineParser struct {
+	// KeepStrings leaves the values as strings rather than guessing whether
+	// they're numbers
+	KeepStrings bool
+
 	fields           []string
 	numFields        int
 	trimLeadingSpace bool
@@ -86,7 +108,9 @@ func (p *CSVLineParser) ParseLine(line string) (map[string]interface{}, error) {
 	}
 
 	for i := 0; i < p.numFields; i++ {
-		if val, err := strconv.Atoi(values[i]); err == nil {
+		if p.KeepStrings {
+			data[p.fields[i]] = values[i]
+		} else if val, err := strconv.Atoi(values[i]); err == nil {
 			data[p.fields[i]] = val
 		} else if val, err := strconv.ParseFloat(values[i], 64); err == nil {
 			data[p.fields[i]] = val
@@ -98,7 +122,7 @@ func (p *CSVLineParser) ParseLine(line string) (map[string]interface{}, error) {
 	return data, nil
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	// parse lines one by one
 	wg := sync.WaitGroup{}
 	numParsers := 1
@@ -108,7 +132,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
+			for rawLine := range lines {
+				line := rawLine.Text
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("attempting to process csv line")
@@ -123,6 +148,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 
 				parsedLine, err := p.lineParser.ParseLine(line)
 				if err != nil {
+					p.unparsed.Report(rawLine, err)
 					continue
 				}
 
@@ -130,6 +156,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					logrus.WithFields(logrus.Fields{
 						"line": line,
 					}).Info("skipping line, no values found")
+					p.unparsed.Report(rawLine, errors.New("no values found"))
 					continue
 				}
 
@@ -137,6 +164,10 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 
 				// look for the timestamp in any of the prefix fields or regular content
 				timestamp := httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
@@ -145,6 +176,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
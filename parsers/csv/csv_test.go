@@ -160,6 +160,15 @@ func TestParseLineTrimWhitespace(t *testing.T) {
 	}
 }
 
+func TestParseLineKeepStrings(t *testing.T) {
+	p := &Parser{keepStrings: true}
+	err := p.Init(&Options{Fields: "zip,count"})
+	assert.NoError(t, err)
+	resp, err := p.lineParser.ParseLine("02134,3")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"zip": "02134", "count": "3"}, resp)
+}
+
 type testLineMaps struct {
 	line        string
 	trimmedLine string
@@ -195,11 +204,11 @@ func TestProcessLines(t *testing.T) {
 	})
 	assert.NoError(t, err, "Couldn't instantiate Parser")
 
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
@@ -4,8 +4,11 @@ package htjson
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -21,9 +24,25 @@ type Options struct {
 	NumParsers int `hidden:"true" description:"number of htjson parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("json", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed, keepStrings: settings.NoTypeInference}
+	}, Options{}, parsers.WithTitle("JSON"), parsers.WithLineParser(func(p parsers.Parser) parsers.LineParser {
+		return p.(*Parser).lineParser
+	}), parsers.WithLineTimer(func(p parsers.Parser) parsers.LineTimer {
+		conf := p.(*Parser).conf
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			return httime.FindTimestamp(parsed, conf.TimeFieldName, conf.TimeFieldFormat)
+		}
+	}))
+}
+
 type Parser struct {
-	conf       Options
-	lineParser parsers.LineParser
+	conf        Options
+	lineParser  parsers.LineParser
+	unparsed    parsers.UnparsedFunc
+	keepStrings bool
 
 	warnedAboutTime bool
 }
@@ -31,11 +50,15 @@ type Parser struct {
 func (p *Parser) Init(options interface{}) error {
 	p.conf = *options.(*Options)
 
-	p.lineParser = &JSONLineParser{}
+	p.lineParser = &JSONLineParser{KeepStrings: p.keepStrings}
 	return nil
 }
 
 type JSONLineParser struct {
+	// KeepStrings leaves numbers as strings, written the way they are in the
+	// line, rather than making them float64s, which can't hold big IDs
+	// exactly
+	KeepStrings bool
 }
 
 // ParseLine will unmarshal the thing it read in to detect errors in the JSON
@@ -43,11 +66,43 @@ type JSONLineParser struct {
 // various filters honeytail might apply.
 func (j *JSONLineParser) ParseLine(line string) (map[string]interface{}, error) {
 	parsed := make(map[string]interface{})
-	err := json.Unmarshal([]byte(line), &parsed)
-	return parsed, err
+	if !j.KeepStrings {
+		err := json.Unmarshal([]byte(line), &parsed)
+		return parsed, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err != nil {
+		return parsed, err
+	}
+	// like json.Unmarshal, don't allow anything after the object
+	if _, err := decoder.Token(); err != io.EOF {
+		return parsed, errors.New("invalid character after top-level value")
+	}
+	for k, v := range parsed {
+		parsed[k] = numbersToStrings(v)
+	}
+	return parsed, nil
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+// numbersToStrings replaces the json.Numbers in v with strings
+func numbersToStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		return string(v)
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = numbersToStrings(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = numbersToStrings(val)
+		}
+	}
+	return v
+}
+
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	wg := sync.WaitGroup{}
 	numParsers := 1
 	if p.conf.NumParsers > 0 {
@@ -56,8 +111,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for rawLine := range lines {
+				line := strings.TrimSpace(rawLine.Text)
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("Attempting to process json log line")
@@ -78,6 +133,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 						"line":  line,
 						"error": err,
 					}).Debug("skipping line; failed to parse.")
+					p.unparsed.Report(rawLine, err)
 					continue
 				}
 				timestamp := httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
@@ -86,11 +142,18 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 
 				// send an event to Transmission
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
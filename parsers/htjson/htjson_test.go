@@ -49,3 +49,22 @@ func TestParseLine(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLineKeepStrings(t *testing.T) {
+	jlp := JSONLineParser{KeepStrings: true}
+	resp, err := jlp.ParseLine(`{"id": 12345678901234567890, "ok": true, "sizes": [1.50, 2]}`)
+	if err != nil {
+		t.Error("jlp.ParseLine unexpectedly returned error ", err)
+	}
+	expected := map[string]interface{}{
+		"id":    "12345678901234567890",
+		"ok":    true,
+		"sizes": []interface{}{"1.50", "2"},
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+	if _, err := jlp.ParseLine(`{"id": 1} {"id": 2}`); err == nil {
+		t.Error("expected an error for a line with more than one object")
+	}
+}
@@ -2,10 +2,12 @@
 package keyval
 
 import (
+	"errors"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kr/logfmt"
 	"github.com/sirupsen/logrus"
@@ -24,10 +26,26 @@ type Options struct {
 	NumParsers int `hidden:"true" description:"number of keyval parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("keyval", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed, keepStrings: settings.NoTypeInference}
+	}, Options{}, parsers.WithTitle("KeyVal"), parsers.WithLineParser(func(p parsers.Parser) parsers.LineParser {
+		return p.(*Parser).lineParser
+	}), parsers.WithLineTimer(func(p parsers.Parser) parsers.LineTimer {
+		conf := p.(*Parser).conf
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			return httime.FindTimestamp(parsed, conf.TimeFieldName, conf.TimeFieldFormat)
+		}
+	}))
+}
+
 type Parser struct {
 	conf        Options
 	lineParser  parsers.LineParser
 	filterRegex *regexp.Regexp
+	unparsed    parsers.UnparsedFunc
+	keepStrings bool
 
 	warnedAboutTime bool
 }
@@ -41,11 +59,14 @@ func (p *Parser) Init(options interface{}) error {
 		}
 	}
 
-	p.lineParser = &KeyValLineParser{}
+	p.lineParser = &KeyValLineParser{KeepStrings: p.keepStrings}
 	return nil
 }
 
 type KeyValLineParser struct {
+	// KeepStrings leaves the values as strings rather than guessing whether
+	// they're bools or numbers
+	KeepStrings bool
 }
 
 func (j *KeyValLineParser) ParseLine(line string) (map[string]interface{}, error) {
@@ -53,6 +74,10 @@ func (j *KeyValLineParser) ParseLine(line string) (map[string]interface{}, error
 	f := func(key, val []byte) error {
 		keyStr := string(key)
 		valStr := string(val)
+		if j.KeepStrings {
+			parsed[keyStr] = valStr
+			return nil
+		}
 		if b, err := strconv.ParseBool(valStr); err == nil {
 			parsed[keyStr] = b
 			return nil
@@ -72,7 +97,7 @@ func (j *KeyValLineParser) ParseLine(line string) (map[string]interface{}, error
 	return parsed, err
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	wg := sync.WaitGroup{}
 	numParsers := 1
 	if p.conf.NumParsers > 0 {
@@ -81,8 +106,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for rawLine := range lines {
+				line := strings.TrimSpace(rawLine.Text)
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("Attempting to process keyval log line")
@@ -115,6 +140,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 						"line":  line,
 						"error": err,
 					}).Debug("skipping line; failed to parse.")
+					p.unparsed.Report(rawLine, err)
 					continue
 				}
 				if len(parsedLine) == 0 {
@@ -123,6 +149,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 						"line":  line,
 						"error": err,
 					}).Debug("skipping line; no key/val pairs found.")
+					p.unparsed.Report(rawLine, errors.New("no key/val pairs found"))
 					continue
 				}
 				if allEmpty(parsedLine) {
@@ -132,12 +159,17 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 						"line":  line,
 						"error": err,
 					}).Debug("skipping line; all values are the empty string.")
+					p.unparsed.Report(rawLine, errors.New("all values are the empty string"))
 					continue
 				}
 				// merge the prefix fields and the parsed line contents
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 
 				// look for the timestamp in any of the prefix fields or regular content
 				timestamp := httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
@@ -146,6 +178,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
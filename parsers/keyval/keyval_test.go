@@ -55,6 +55,18 @@ func TestParseLine(t *testing.T) {
 	}
 }
 
+func TestParseLineKeepStrings(t *testing.T) {
+	jlp := KeyValLineParser{KeepStrings: true}
+	resp, err := jlp.ParseLine("zip=02134 ok=true ratio=0.5")
+	if err != nil {
+		t.Error("jlp.ParseLine unexpectedly returned error ", err)
+	}
+	expected := map[string]interface{}{"zip": "02134", "ok": "true", "ratio": "0.5"}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+}
+
 func TestBrokenFilterRegex(t *testing.T) {
 	// test filter that doesn't compile
 	broken := &Parser{}
@@ -121,12 +133,12 @@ func TestFilterRegex(t *testing.T) {
 			FilterRegex:  tst.filterString,
 			InvertFilter: tst.invertFilter,
 		})
-		lines := make(chan string)
+		lines := make(chan event.Line)
 		send := make(chan event.Event)
 		// send input into lines in a goroutine then close the lines channel
 		go func() {
 			for _, line := range tst.lines {
-				lines <- line
+				lines <- event.Line{Text: line}
 			}
 			close(lines)
 		}()
@@ -152,12 +164,12 @@ func TestFilterRegex(t *testing.T) {
 func TestDontReturnEmptyEvents(t *testing.T) {
 	p := &Parser{}
 	p.Init(&Options{})
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	// send input into lines in a goroutine then close the lines channel
 	go func() {
 		for _, line := range []string{"one", "two", "three"} {
-			lines <- line
+			lines <- event.Line{Text: line}
 		}
 		close(lines)
 	}()
@@ -184,12 +196,12 @@ func TestDontReturnEmptyEvents(t *testing.T) {
 func TestDontReturnUselessEvents(t *testing.T) {
 	p := &Parser{}
 	p.Init(&Options{})
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	// send input into lines in a goroutine then close the lines channel
 	go func() {
 		for _, line := range []string{"key=", "key2=", "key= key2="} {
-			lines <- line
+			lines <- event.Line{Text: line}
 		}
 		close(lines)
 	}()
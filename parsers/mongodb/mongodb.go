@@ -53,8 +53,16 @@ type Options struct {
 	NumParsers int `hidden:"true" description:"number of mongo parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("mongo", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("MongoDB"), parsers.WithAliases("mongodb"))
+}
+
 type Parser struct {
-	conf Options
+	conf     Options
+	unparsed parsers.UnparsedFunc
 
 	lock              sync.RWMutex
 	currentReplicaSet string
@@ -72,7 +80,7 @@ func (p *Parser) Init(options interface{}) error {
 	return nil
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	wg := sync.WaitGroup{}
 	numParsers := 1
 	if p.conf.NumParsers > 0 {
@@ -82,8 +90,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 		wg.Add(1)
 		go func() {
 			lineParser := &MongoLineParser{}
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for rawLine := range lines {
+				line := strings.TrimSpace(rawLine.Text)
 				// take care of any headers on the line
 				var prefixFields map[string]string
 				if prefixRegex != nil {
@@ -96,23 +104,23 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				if err == nil || (p.conf.LogPartials && logparser.IsPartialLogLine(err)) {
 					timestamp, err := p.parseTimestamp(values)
 					if err != nil {
-						logFailure(line, err, "couldn't parse logline timestamp, skipping")
+						p.logFailure(rawLine, line, err, "couldn't parse logline timestamp, skipping")
 						continue
 					}
 					if err = p.decomposeSharding(values); err != nil {
-						logFailure(line, err, "couldn't decompose sharding changelog, skipping")
+						p.logFailure(rawLine, line, err, "couldn't decompose sharding changelog, skipping")
 						continue
 					}
 					if err = p.decomposeNamespace(values); err != nil {
-						logFailure(line, err, "couldn't decompose logline namespace, skipping")
+						p.logFailure(rawLine, line, err, "couldn't decompose logline namespace, skipping")
 						continue
 					}
 					if err = p.decomposeLocks(values); err != nil {
-						logFailure(line, err, "couldn't decompose logline locks, skipping")
+						p.logFailure(rawLine, line, err, "couldn't decompose logline locks, skipping")
 						continue
 					}
 					if err = p.decomposeLocksMicros(values); err != nil {
-						logFailure(line, err, "couldn't decompose logline locks(micros), skipping")
+						p.logFailure(rawLine, line, err, "couldn't decompose logline locks(micros), skipping")
 						continue
 					}
 
@@ -147,6 +155,10 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					for k, v := range prefixFields {
 						values[k] = v
 					}
+					// and anything known about where the line came from
+					for k, v := range rawLine.Fields {
+						values[k] = v
+					}
 
 					logrus.WithFields(logrus.Fields{
 						"line":   line,
@@ -160,9 +172,12 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					send <- event.Event{
 						Timestamp: timestamp,
 						Data:      values,
+						Source:    rawLine.Source,
+						Offset:    rawLine.Offset,
+						Dataset:   rawLine.Dataset,
 					}
 				} else {
-					logFailure(line, err, "logline didn't parse, skipping.")
+					p.logFailure(rawLine, line, err, "logline didn't parse, skipping.")
 				}
 			}
 			wg.Done()
@@ -410,6 +425,8 @@ func (p *Parser) getCommandQuery(values map[string]interface{}) {
 	}
 }
 
-func logFailure(line string, err error, msg string) {
+// logFailure logs why a line was skipped and reports it as unparsed
+func (p *Parser) logFailure(rawLine event.Line, line string, err error, msg string) {
 	logrus.WithFields(logrus.Fields{"line": line}).WithError(err).Debugln(msg)
+	p.unparsed.Report(rawLine, err)
 }
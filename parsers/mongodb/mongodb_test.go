@@ -437,12 +437,12 @@ func TestProcessLines(t *testing.T) {
 			NumParsers: 1,
 		},
 	}
-	lines := make(chan string, len(tlm))
+	lines := make(chan event.Line, len(tlm))
 	send := make(chan event.Event, len(tlm))
 	// prep the incoming channel with test lines for the processor
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
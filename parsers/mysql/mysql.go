@@ -3,6 +3,7 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"regexp"
@@ -137,6 +138,13 @@ type Options struct {
 	NumParsers int `hidden:"true" description:"number of MySQL parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("mysql", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{SampleRate: settings.SampleRate, unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("MySQL"))
+}
+
 type Parser struct {
 	// set SampleRate to cause the MySQL parser to drop events after before
 	// they're parsed to save CPU
@@ -151,6 +159,7 @@ type Parser struct {
 	readOnly   *bool
 	replicaLag *int64
 	role       *string
+	unparsed   parsers.UnparsedFunc
 }
 
 // the normalizer can't be shared by all threads.
@@ -321,9 +330,16 @@ func (p *Parser) randIntn(n int) int {
 	return p.Rand.Intn(n)
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+// rawEvent is a group of lines that seem to represent a single event, along
+// with the last of them, which tells where in the log the event ends
+type rawEvent struct {
+	lines []string
+	last  event.Line
+}
+
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	// start up a goroutine to handle grouped sets of lines
-	rawEvents := make(chan []string)
+	rawEvents := make(chan rawEvent)
 	defer p.wg.Wait()
 	p.wg.Add(1)
 	go p.handleEvents(rawEvents, send)
@@ -331,8 +347,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	// flag to indicate when we've got a complete event to send
 	var foundStatement bool
 	groupedLines := make([]string, 0, 5)
-	for line := range lines {
-		line = strings.TrimSpace(line)
+	var lastLine event.Line
+	for rawLine := range lines {
+		line := strings.TrimSpace(rawLine.Text)
 		// mysql parser does not support capturing fields in the line prefix - just
 		// strip it.
 		if prefixRegex != nil {
@@ -352,25 +369,26 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				foundStatement = false
 				// if sampling is disabled or sampler says keep, pass along this group.
 				if p.SampleRate <= 1 || p.randIntn(p.SampleRate) == 0 {
-					rawEvents <- groupedLines
+					rawEvents <- rawEvent{lines: groupedLines, last: lastLine}
 				}
 				groupedLines = make([]string, 0, 5)
 			}
 		}
 		groupedLines = append(groupedLines, line)
+		lastLine = rawLine
 	}
 	// send the last event, if there was one collected
 	if foundStatement {
 		// if sampling is disabled or sampler says keep, pass along this group.
 		if p.SampleRate <= 1 || p.randIntn(p.SampleRate) == 0 {
-			rawEvents <- groupedLines
+			rawEvents <- rawEvent{lines: groupedLines, last: lastLine}
 		}
 	}
 	logrus.Debug("lines channel is closed, ending mysql processor")
 	close(rawEvents)
 }
 
-func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event) {
+func (p *Parser) handleEvents(rawEvents <-chan rawEvent, send chan<- event.Event) {
 	defer p.wg.Done()
 	wg := sync.WaitGroup{}
 	numParsers := 1
@@ -384,12 +402,19 @@ func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event
 		wg.Add(1)
 		go func() {
 			for rawE := range rawEvents {
-				sq, timestamp := p.handleEvent(&ptp, rawE)
+				sq, timestamp := p.handleEvent(&ptp, rawE.lines)
 				if len(sq) == 0 {
 					continue
 				}
 				if q, ok := sq["query"]; !ok || q == "" {
 					// skip events with no query field
+					p.unparsed.Report(event.Line{
+						Text:    strings.Join(rawE.lines, "\n"),
+						Source:  rawE.last.Source,
+						Offset:  rawE.last.Offset,
+						Fields:  rawE.last.Fields,
+						Dataset: rawE.last.Dataset,
+					}, errors.New("no query found"))
 					continue
 				}
 				if p.hostedOn != "" {
@@ -404,10 +429,16 @@ func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event
 				if p.role != nil {
 					sq[roleKey] = *p.role
 				}
+				for k, v := range rawE.last.Fields {
+					sq[k] = v
+				}
 				send <- event.Event{
 					Timestamp:  timestamp,
 					SampleRate: p.SampleRate,
 					Data:       sq,
+					Source:     rawE.last.Source,
+					Offset:     rawE.last.Offset,
+					Dataset:    rawE.last.Dataset,
 				}
 			}
 			wg.Done()
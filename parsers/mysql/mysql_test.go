@@ -847,14 +847,14 @@ func TestProcessLines(t *testing.T) {
 			},
 			// normalizer: &normalizer.Parser{},
 		}
-		lines := make(chan string, 10)
+		lines := make(chan event.Line, 10)
 		send := make(chan event.Event, 5)
 		go func() {
 			p.ProcessLines(lines, send, nil)
 			close(send)
 		}()
 		for _, line := range tt.in {
-			lines <- line
+			lines <- event.Line{Text: line}
 		}
 		close(lines)
 
@@ -888,14 +888,14 @@ func TestProcessLines(t *testing.T) {
 			Rand:       rng,
 			// normalizer: &normalizer.Parser{},
 		}
-		lines := make(chan string, 10)
+		lines := make(chan event.Line, 10)
 		send := make(chan event.Event, 5)
 		go func() {
 			p.ProcessLines(lines, send, nil)
 			close(send)
 		}()
 		for _, line := range tt.in {
-			lines <- line
+			lines <- event.Line{Text: line}
 		}
 		close(lines)
 		for range send {
@@ -23,25 +23,61 @@ const (
 	iso8601TimeLayout         = "2006-01-02T15:04:05-07:00"
 )
 
+// KnownFormat is a common access log format that can be used with
+// --nginx.log_format
+type KnownFormat struct {
+	Name   string
+	Format string
+}
+
+// KnownFormats are the access log formats Nginx and Apache use by default,
+// with the ones that have the most fields first
+var KnownFormats = []KnownFormat{
+	// the format of Nginx's default config file
+	{Name: "main", Format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`},
+	// Apache's vhost_combined
+	{Name: "vhost_combined", Format: `$server_name:$server_port $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`},
+	// predefined by Nginx, and Apache's combined
+	{Name: "combined", Format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`},
+	// Apache's common
+	{Name: "common", Format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`},
+}
+
 type Options struct {
 	ConfigFile      string `long:"conf" description:"Path to Nginx config file"`
 	LogFormatName   string `long:"format" description:"Log format name to look for in the Nginx config file"`
 	TimeFieldName   string `long:"timefield" description:"Name of the field that contains a timestamp"`
 	TimeFieldFormat string `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
+	LogFormat       string `long:"log_format" description:"Log format to parse lines with, in place of looking up --nginx.format in --nginx.conf"`
 
 	NumParsers int `hidden:"true" description:"number of nginx parsers to spin up"`
 }
 
+func init() {
+	parsers.Register("nginx", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed, keepStrings: settings.NoTypeInference}
+	}, Options{}, parsers.WithTitle("Nginx"))
+}
+
 type Parser struct {
-	conf       Options
-	lineParser parsers.LineParser
+	conf        Options
+	lineParser  parsers.LineParser
+	unparsed    parsers.UnparsedFunc
+	keepStrings bool
 }
 
 func (n *Parser) Init(options interface{}) error {
 	n.conf = *options.(*Options)
 
+	if n.conf.LogFormat != "" {
+		gonxParser := NewGonxLineParser(n.conf.LogFormat)
+		gonxParser.KeepStrings = n.keepStrings
+		n.lineParser = gonxParser
+		return nil
+	}
 	if n.conf.ConfigFile == "" {
-		return errors.New("missing required option --nginx.conf=<path to your Nginx config file>")
+		return errors.New("missing required option --nginx.conf=<path to your Nginx config file> or --nginx.log_format=<log format>")
 	}
 
 	// Verify we've got our config, find our format
@@ -57,16 +93,27 @@ func (n *Parser) Init(options interface{}) error {
 		return err
 	}
 	gonxParser := &GonxLineParser{
-		parser: parser,
+		parser:      parser,
+		KeepStrings: n.keepStrings,
 	}
 	n.lineParser = gonxParser
 	return nil
 }
 
 type GonxLineParser struct {
+	// KeepStrings leaves the values as strings rather than guessing whether
+	// they're numbers
+	KeepStrings bool
+
 	parser *gonx.Parser
 }
 
+// NewGonxLineParser returns a line parser for an Nginx log_format, eg. one of
+// the KnownFormats
+func NewGonxLineParser(format string) *GonxLineParser {
+	return &GonxLineParser{parser: gonx.NewParser(format)}
+}
+
 func (g *GonxLineParser) ParseLine(line string) (map[string]interface{}, error) {
 	gonxEvent, err := g.parser.ParseString(line)
 	if err != nil {
@@ -76,17 +123,20 @@ func (g *GonxLineParser) ParseLine(line string) (map[string]interface{}, error)
 		}).Debug("failed to parse nginx log line")
 		return nil, err
 	}
+	if g.KeepStrings {
+		return stringifyParsedLine(gonxEvent.Fields), nil
+	}
 	return typeifyParsedLine(gonxEvent.Fields), nil
 }
 
-func (n *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (n *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	// parse lines one by one
 	wg := sync.WaitGroup{}
 	for i := 0; i < n.conf.NumParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for rawLine := range lines {
+				line := strings.TrimSpace(rawLine.Text)
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("Attempting to process nginx log line")
@@ -97,22 +147,34 @@ func (n *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					var prefix string
 					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
 					line = strings.TrimPrefix(line, prefix)
-					prefixFields = typeifyParsedLine(fields)
+					if n.keepStrings {
+						prefixFields = stringifyParsedLine(fields)
+					} else {
+						prefixFields = typeifyParsedLine(fields)
+					}
 				}
 
 				parsedLine, err := n.lineParser.ParseLine(line)
 				if err != nil {
+					n.unparsed.Report(rawLine, err)
 					continue
 				}
 				// merge the prefix fields and the parsed line contents
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 				timestamp := n.getTimestamp(parsedLine)
 
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
@@ -150,6 +212,19 @@ func typeifyParsedLine(pl map[string]string) map[string]interface{} {
 	return msi
 }
 
+// stringifyParsedLine is typeifyParsedLine without the numbers
+func stringifyParsedLine(pl map[string]string) map[string]interface{} {
+	msi := make(map[string]interface{}, len(pl))
+	for k, v := range pl {
+		if v == "-" {
+			// no value, don't set a "-" string
+			continue
+		}
+		msi[k] = v
+	}
+	return msi
+}
+
 // tries to extract a timestamp from the log line
 func (n *Parser) getTimestamp(evMap map[string]interface{}) time.Time {
 	var (
@@ -58,11 +58,11 @@ func TestProcessLines(t *testing.T) {
 			parser: gonx.NewParser("$http_x_forwarded_proto - $remote_addr - $remote_user [$time_local] $status $body_bytes_sent $request_time $traceId $id"),
 		},
 	}
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
@@ -102,11 +102,11 @@ func TestProcessLinesNoPreReg(t *testing.T) {
 			parser: gonx.NewParser("$http_x_forwarded_proto - $remote_addr - $remote_user [$time_local] $status $body_bytes_sent $request_time"),
 		},
 	}
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
@@ -291,3 +291,46 @@ func TestGetTimestamp(t *testing.T) {
 		}
 	}
 }
+
+func TestInitLogFormat(t *testing.T) {
+	p := &Parser{}
+	if err := p.Init(&Options{}); err == nil {
+		t.Error("expected an error without --nginx.conf or --nginx.log_format")
+	}
+	if err := p.Init(&Options{LogFormat: KnownFormats[len(KnownFormats)-1].Format}); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := p.lineParser.ParseLine(`10.0.0.1 - - [08/Oct/2015:00:26:26 +0000] "GET / HTTP/1.1" 200 174`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"remote_addr":     "10.0.0.1",
+		"time_local":      "08/Oct/2015:00:26:26 +0000",
+		"request":         "GET / HTTP/1.1",
+		"status":          int64(200),
+		"body_bytes_sent": int64(174),
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("expected %v, got %v", expected, parsed)
+	}
+}
+
+func TestInitKeepStrings(t *testing.T) {
+	p := &Parser{keepStrings: true}
+	if err := p.Init(&Options{LogFormat: `$remote_addr $status $request_time $upstream_addr`}); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := p.lineParser.ParseLine(`10.0.0.1 200 0.099 -`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"remote_addr":  "10.0.0.1",
+		"status":       "200",
+		"request_time": "0.099",
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("expected %v, got %v", expected, parsed)
+	}
+}
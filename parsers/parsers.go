@@ -4,7 +4,11 @@
 // any necessary or relevant smarts for that style of logs.
 package parsers
 
-import "github.com/honeycombio/honeytail/event"
+import (
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
 
 type Parser interface {
 	// Init does any initialization necessary for the module
@@ -12,9 +16,28 @@ type Parser interface {
 	// ProcessLines consumes log lines from the lines channel and sends log events
 	// to the send channel. prefixRegex, if not nil, will be stripped from the
 	// line prior to parsing. Any named groups will be added to the event.
-	ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *ExtRegexp)
+	// Each event gets the Source and Offset of the last line that went into it.
+	ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *ExtRegexp)
 }
 
 type LineParser interface {
 	ParseLine(line string) (map[string]interface{}, error)
 }
+
+// LineTimer finds the time of a line parsed by a LineParser the way its
+// parser does for the line's event, deleting the field it was in. It returns
+// false if the line has no time.
+type LineTimer func(parsed map[string]interface{}) (time.Time, bool)
+
+// UnparsedFunc is told about each line a parser couldn't make an event from,
+// and why. For parsers that group several lines into an event, the line has
+// all the lines of the group joined by newlines, and the Source and Offset of
+// the last of them.
+type UnparsedFunc func(line event.Line, err error)
+
+// Report calls f, if it's set
+func (f UnparsedFunc) Report(line event.Line, err error) {
+	if f != nil {
+		f(line, err)
+	}
+}
@@ -50,6 +50,7 @@
 package postgresql
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -113,9 +114,16 @@ type Options struct {
 	LogLinePrefix string `long:"log_line_prefix" description:"Format string for PostgreSQL log line prefix"`
 }
 
+func init() {
+	parsers.Register("postgresql", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		return &Parser{unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("PostgreSQL"))
+}
+
 type Parser struct {
 	// regex to match the log_line_prefix format specified by the user
 	pgPrefixRegex *parsers.ExtRegexp
+	unparsed      parsers.UnparsedFunc
 }
 
 func (p *Parser) Init(options interface{}) (err error) {
@@ -130,13 +138,22 @@ func (p *Parser) Init(options interface{}) (err error) {
 	return err
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
-	rawEvents := make(chan []string)
+// rawEvent is a single grouped log statement, along with the last of its
+// lines, which tells where in the log the statement ends
+type rawEvent struct {
+	lines []string
+	last  event.Line
+}
+
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	rawEvents := make(chan rawEvent)
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go p.handleEvents(rawEvents, send, wg)
 	var groupedLines []string
-	for line := range lines {
+	var lastLine event.Line
+	for rawLine := range lines {
+		line := rawLine.Text
 		if prefixRegex != nil {
 			// This is the "global" prefix regex as specified by the
 			// --log_prefix option, for stripping prefixes added by syslog or
@@ -150,13 +167,14 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 		if !isContinuationLine(line) && len(groupedLines) > 0 {
 			// If the line we just parsed is the start of a new log statement,
 			// send off the previously accumulated group.
-			rawEvents <- groupedLines
+			rawEvents <- rawEvent{lines: groupedLines, last: lastLine}
 			groupedLines = make([]string, 0, 1)
 		}
 		groupedLines = append(groupedLines, line)
+		lastLine = rawLine
 	}
 
-	rawEvents <- groupedLines
+	rawEvents <- rawEvent{lines: groupedLines, last: lastLine}
 	close(rawEvents)
 	wg.Wait()
 }
@@ -164,23 +182,39 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 // handleEvents receives sets of grouped log lines, each representing a single
 // log statement. It attempts to parse them, and sends the events it constructs
 // down the send channel.
-func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event, wg *sync.WaitGroup) {
+func (p *Parser) handleEvents(rawEvents <-chan rawEvent, send chan<- event.Event, wg *sync.WaitGroup) {
 	defer wg.Done()
 	// TODO: spin up a group of goroutines to do this
 	for rawEvent := range rawEvents {
-		ev := p.handleEvent(rawEvent)
+		ev, err := p.handleEvent(rawEvent.lines)
+		if err != nil {
+			p.unparsed.Report(event.Line{
+				Text:    strings.Join(rawEvent.lines, "\n"),
+				Source:  rawEvent.last.Source,
+				Offset:  rawEvent.last.Offset,
+				Fields:  rawEvent.last.Fields,
+				Dataset: rawEvent.last.Dataset,
+			}, err)
+		}
 		if ev != nil {
+			ev.Source = rawEvent.last.Source
+			ev.Offset = rawEvent.last.Offset
+			ev.Dataset = rawEvent.last.Dataset
+			for k, v := range rawEvent.last.Fields {
+				ev.Data[k] = v
+			}
 			send <- *ev
 		}
 	}
 }
 
 // handleEvent takes a single grouped log statement (an array of lines) and attempts to parse it.
-// It returns a pointer to an Event if successful, and nil if not.
-func (p *Parser) handleEvent(rawEvent []string) *event.Event {
+// It returns a pointer to an Event if successful, and nil if not, along with
+// an error if that's because the statement didn't parse.
+func (p *Parser) handleEvent(rawEvent []string) (*event.Event, error) {
 	normalizer := normalizer.Parser{}
 	if len(rawEvent) == 0 {
-		return nil
+		return nil, nil
 	}
 	firstLine := rawEvent[0]
 
@@ -190,7 +224,7 @@ func (p *Parser) handleEvent(rawEvent []string) *event.Event {
 		// Note: this may be noisy when debug logging is turned on, since the
 		// postgres general log contains lots of other statements as well.
 		logrus.WithField("line", firstLine).Debug("Log line prefix didn't match expected format")
-		return nil
+		return nil, errors.New("log line prefix didn't match expected format")
 	}
 
 	ev := &event.Event{
@@ -204,7 +238,7 @@ func (p *Parser) handleEvent(rawEvent []string) *event.Event {
 
 	if !match {
 		logrus.WithField("line", firstLine).Debug("didn't find slow query header, skipping line")
-		return nil
+		return nil, nil
 	}
 
 	if rawDuration, ok := slowQueryMeta["duration"]; ok {
@@ -247,7 +281,7 @@ func (p *Parser) handleEvent(rawEvent []string) *event.Event {
 		ev.Data["comments"] = "/* " + strings.Join(normalizer.LastComments, " */ /* ") + " */"
 	}
 
-	return ev
+	return ev, nil
 }
 
 func parseTraceData(query string) (matched bool, fields map[string]string) {
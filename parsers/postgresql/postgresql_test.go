@@ -217,14 +217,14 @@ func TestSingleQueryParsing(t *testing.T) {
 
 	for _, tc := range testcases {
 		t.Run(tc.description, func(t *testing.T) {
-			in := make(chan []string)
+			in := make(chan rawEvent)
 			out := make(chan event.Event)
 			p := Parser{}
 			p.Init(&Options{LogLinePrefix: tc.prefixFormat})
 			wg := &sync.WaitGroup{}
 			wg.Add(1)
 			go p.handleEvents(in, out, wg)
-			in <- strings.Split(tc.in, "\n")
+			in <- rawEvent{lines: strings.Split(tc.in, "\n")}
 			close(in)
 			got := <-out
 			assert.Equal(t, tc.expected, got)
@@ -299,11 +299,11 @@ func TestMultipleQueryParsing(t *testing.T) {
 
 	parser := Parser{}
 	parser.Init(nil)
-	inChan := make(chan string)
+	inChan := make(chan event.Line)
 	sendChan := make(chan event.Event, 4)
 	go parser.ProcessLines(inChan, sendChan, nil)
 	for _, line := range strings.Split(in, "\n") {
-		inChan <- line
+		inChan <- event.Line{Text: line}
 	}
 	close(inChan)
 	for _, expected := range out {
@@ -324,7 +324,7 @@ func TestSkipNonQueryLogLines(t *testing.T) {
 
 	for _, tc := range testcases {
 		lineGroup := []string{tc}
-		ev := parser.handleEvent(lineGroup)
+		ev, _ := parser.handleEvent(lineGroup)
 		assert.Nil(t, ev)
 	}
 }
@@ -338,7 +338,7 @@ func TestEnsureRegexMatchesBeginningOfLine(t *testing.T) {
 	line := "[PUCE] [200-1]  sql_error_code = 00000 LOG:  duration: 1050.729 ms  execute <unnamed>: UPDATE \"repositories\" SET \"current_build_id\" = 341933279, \"updated_at\" = '2018-02-15 15:21:55.174858' WHERE \"repositories\".\"id\" = 16235973"
 
 	lineGroup := []string{line}
-	got := parser.handleEvent(lineGroup)
+	got, _ := parser.handleEvent(lineGroup)
 	assert.Nil(t, got)
 }
 
@@ -362,6 +362,6 @@ func TestCustomLogLinePrefix(t *testing.T) {
 	}
 
 	lineGroup := []string{line}
-	got := parser.handleEvent(lineGroup)
+	got, _ := parser.handleEvent(lineGroup)
 	assert.Equal(t, expected, got)
 }
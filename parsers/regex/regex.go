@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -29,9 +30,24 @@ type Options struct {
 	NumParsers      int      `hidden:"true" description:"number of regex parsers to spin up" yaml:"-"`
 }
 
+func init() {
+	parsers.Register("regex", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("Regex"), parsers.WithLineParser(func(p parsers.Parser) parsers.LineParser {
+		return p.(*Parser).lineParser
+	}), parsers.WithLineTimer(func(p parsers.Parser) parsers.LineTimer {
+		conf := p.(*Parser).conf
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			return httime.FindTimestamp(parsed, conf.TimeFieldName, conf.TimeFieldFormat)
+		}
+	}))
+}
+
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	unparsed   parsers.UnparsedFunc
 }
 
 func (p *Parser) Init(options interface{}) error {
@@ -142,7 +158,7 @@ func (p *RegexLineParser) ParseLine(line string) (map[string]interface{}, error)
 	return make(map[string]interface{}), nil
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	// parse lines one by one
 	wg := sync.WaitGroup{}
 	numParsers := 1
@@ -152,7 +168,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
+			for rawLine := range lines {
+				line := rawLine.Text
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("Attempting to process regex log line")
@@ -167,6 +184,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 
 				parsedLine, err := p.lineParser.ParseLine(line)
 				if err != nil {
+					p.unparsed.Report(rawLine, err)
 					continue
 				}
 
@@ -174,11 +192,16 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 
 				if len(parsedLine) == 0 {
 					logrus.WithFields(logrus.Fields{
 						"line": line,
 					}).Debug("Skipping line; no capture groups found")
+					p.unparsed.Report(rawLine, errors.New("no capture groups found"))
 					continue
 				}
 
@@ -189,6 +212,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
@@ -257,11 +257,11 @@ func TestProcessLines(t *testing.T) {
 	})
 	assert.NoError(t, err, "Couldn't instantiate Parser")
 
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
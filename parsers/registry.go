@@ -0,0 +1,187 @@
+package parsers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Settings are the honeytail options a parser may need when it's made
+type Settings struct {
+	// NumParsers is how many goroutines to parse lines with
+	NumParsers int
+	// Ordered is set when events have to come out of the parser in the same
+	// order as their lines went in. NumParsers is 1 when it's set.
+	Ordered bool
+	// SampleRate is the --samplerate, for parsers that sample their events
+	// themselves
+	SampleRate int
+	// Unparsed is told about the lines that fail to parse
+	Unparsed UnparsedFunc
+	// NoTypeInference is set when parsers that guess the types of the values
+	// they find should leave them as strings instead
+	NoTypeInference bool
+}
+
+// Factory returns a new parser. options is a pointer to the parser's options
+// type, which will be passed to the parser's Init, and may be changed to
+// apply settings.
+type Factory func(options interface{}, settings Settings) Parser
+
+// Registration is a parser added with Register
+type Registration struct {
+	// Name is what --parser picks the parser by, and the namespace of its
+	// flags and its section in the YAML config
+	Name string
+	// Title names the parser in the help, eg. the flags of the "MongoDB"
+	// parser are in the "MongoDB Parser Options" group
+	Title string
+	// Aliases are other names --parser accepts for the parser
+	Aliases []string
+
+	factory     Factory
+	optionsType reflect.Type
+	lineParser  func(Parser) LineParser
+	lineTimer   func(Parser) LineTimer
+}
+
+// RegisterOption changes an optional part of a Registration
+type RegisterOption func(*Registration)
+
+// WithTitle sets the Title of a parser, which defaults to its name
+func WithTitle(title string) RegisterOption {
+	return func(r *Registration) {
+		r.Title = title
+	}
+}
+
+// WithAliases sets the Aliases of a parser
+func WithAliases(aliases ...string) RegisterOption {
+	return func(r *Registration) {
+		r.Aliases = aliases
+	}
+}
+
+// WithLineParser lets the line parser of a parser be used on its own, eg. to
+// parse a field of an event with --subparse. lineParser returns the line
+// parser of an initialized parser.
+func WithLineParser(lineParser func(Parser) LineParser) RegisterOption {
+	return func(r *Registration) {
+		r.lineParser = lineParser
+	}
+}
+
+// WithLineTimer goes with WithLineParser, for parsers that find the time of
+// their events in the parsed line. lineTimer returns the line timer of an
+// initialized parser.
+func WithLineTimer(lineTimer func(Parser) LineTimer) RegisterOption {
+	return func(r *Registration) {
+		r.lineTimer = lineTimer
+	}
+}
+
+// registry has every registered parser by name and by alias
+var registry = struct {
+	sync.Mutex
+	byName map[string]*Registration
+}{byName: make(map[string]*Registration)}
+
+// Register adds a parser for --parser to pick by name. optionsType is the
+// parser's options struct, like Options{}, whose fields become the flags in
+// the --name. namespace and the name section of the YAML config. Parsers
+// register themselves in an init function, so a parser kept outside honeytail
+// is built in with a blank import of its package. Register panics if name or
+// one of the aliases is already taken, or if optionsType isn't a struct.
+func Register(name string, factory Factory, optionsType interface{}, opts ...RegisterOption) {
+	r := &Registration{
+		Name:        name,
+		Title:       name,
+		factory:     factory,
+		optionsType: reflect.TypeOf(optionsType),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.optionsType == nil || r.optionsType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("parsers: options type of %s must be a struct, got %T", name, optionsType))
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, n := range append([]string{name}, r.Aliases...) {
+		if _, ok := registry.byName[n]; ok {
+			panic(fmt.Sprintf("parsers: %s is registered twice", n))
+		}
+		registry.byName[n] = r
+	}
+}
+
+// Registered returns every registered parser, sorted by name
+func Registered() []*Registration {
+	registry.Lock()
+	defer registry.Unlock()
+	var registered []*Registration
+	for n, r := range registry.byName {
+		if n == r.Name {
+			registered = append(registered, r)
+		}
+	}
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Name < registered[j].Name
+	})
+	return registered
+}
+
+// Lookup returns the parser registered with name or an alias of name, or nil
+// if there isn't one
+func Lookup(name string) *Registration {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.byName[name]
+}
+
+// NewOptions returns a pointer to a new, empty options struct for the parser
+func (r *Registration) NewOptions() interface{} {
+	return reflect.New(r.optionsType).Interface()
+}
+
+// CopyOptions returns a pointer to a copy of options, which is a pointer to
+// the parser's options struct, or a new, empty one if options is nil
+func (r *Registration) CopyOptions(options interface{}) interface{} {
+	copied := reflect.New(r.optionsType)
+	if options != nil {
+		copied.Elem().Set(reflect.ValueOf(options).Elem())
+	}
+	return copied.Interface()
+}
+
+// New returns a new parser along with the options to Init it with, which are
+// a copy of options, so settings don't change options.
+func (r *Registration) New(options interface{}, settings Settings) (Parser, interface{}) {
+	options = r.CopyOptions(options)
+	return r.factory(options, settings), options
+}
+
+// NewLineParser returns the line parser of a new parser made with settings and
+// initialized with a copy of options, along with its line timer, which is nil
+// if it has none. It returns an error if the parser has no line parser of its
+// own or fails to initialize.
+func (r *Registration) NewLineParser(options interface{}, settings Settings) (LineParser, LineTimer, error) {
+	if r.lineParser == nil {
+		return nil, nil, fmt.Errorf("the %s parser has no line parser", r.Name)
+	}
+	parser, options := r.New(options, settings)
+	if err := parser.Init(options); err != nil {
+		return nil, nil, err
+	}
+	var lineTimer LineTimer
+	if r.lineTimer != nil {
+		lineTimer = r.lineTimer(parser)
+	}
+	return r.lineParser(parser), lineTimer, nil
+}
+
+// HasLineParser is whether the parser's line parser can be used on its own
+func (r *Registration) HasLineParser() bool {
+	return r.lineParser != nil
+}
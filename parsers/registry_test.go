@@ -0,0 +1,136 @@
+package parsers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+type testOptions struct {
+	NumParsers int
+	Format     string
+}
+
+type testParser struct {
+	options *testOptions
+}
+
+func (p *testParser) Init(options interface{}) error {
+	p.options = options.(*testOptions)
+	return nil
+}
+
+func (p *testParser) ParseLine(line string) (map[string]interface{}, error) {
+	return map[string]interface{}{p.options.Format: line}, nil
+}
+
+func (p *testParser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *ExtRegexp) {
+}
+
+func TestRegister(t *testing.T) {
+	Register("registry_test", func(options interface{}, settings Settings) Parser {
+		options.(*testOptions).NumParsers = settings.NumParsers
+		return &testParser{}
+	}, testOptions{}, WithTitle("Registry Test"), WithAliases("registry_alias"))
+
+	r := Lookup("registry_alias")
+	if r == nil || r.Name != "registry_test" || r.Title != "Registry Test" {
+		t.Fatalf("looking up the alias got %+v", r)
+	}
+	found := false
+	for _, registered := range Registered() {
+		if registered.Name == "registry_alias" {
+			t.Error("aliases shouldn't be listed")
+		}
+		found = found || registered == r
+	}
+	if !found {
+		t.Error("the parser isn't listed")
+	}
+
+	options := &testOptions{Format: "short"}
+	parser, opts := r.New(options, Settings{NumParsers: 4})
+	if err := parser.Init(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := parser.(*testParser).options; *got != (testOptions{NumParsers: 4, Format: "short"}) {
+		t.Errorf("parser got options %+v", got)
+	}
+	if options.NumParsers != 0 {
+		t.Error("settings changed the options passed to New")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an alias twice didn't panic")
+		}
+	}()
+	Register("registry_other", nil, testOptions{}, WithAliases("registry_alias"))
+}
+
+func TestRegisterLineParser(t *testing.T) {
+	Register("registry_line", func(options interface{}, settings Settings) Parser {
+		return &testParser{}
+	}, testOptions{}, WithLineParser(func(p Parser) LineParser {
+		return p.(*testParser)
+	}))
+	lineParser, lineTimer, err := Lookup("registry_line").NewLineParser(&testOptions{Format: "field"}, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := lineParser.ParseLine("value")
+	if parsed["field"] != "value" {
+		t.Errorf("line parser got %v", parsed)
+	}
+	if lineTimer != nil {
+		t.Error("expected no line timer from a parser without one")
+	}
+
+	// the line timer works with the options of the same parser
+	Register("registry_timed", func(options interface{}, settings Settings) Parser {
+		return &testParser{}
+	}, testOptions{}, WithLineParser(func(p Parser) LineParser {
+		return p.(*testParser)
+	}), WithLineTimer(func(p Parser) LineTimer {
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			ts, err := time.Parse(time.RFC3339, parsed[p.(*testParser).options.Format].(string))
+			return ts, err == nil
+		}
+	}))
+	lineParser, lineTimer, err = Lookup("registry_timed").NewLineParser(&testOptions{Format: "time"}, Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ = lineParser.ParseLine("2024-01-02T03:04:05Z")
+	if ts, ok := lineTimer(parsed); !ok || ts.Hour() != 3 {
+		t.Errorf("line timer got %v, %v", ts, ok)
+	}
+
+	Register("registry_no_line", func(options interface{}, settings Settings) Parser {
+		return &testParser{}
+	}, testOptions{})
+	if _, _, err := Lookup("registry_no_line").NewLineParser(nil, Settings{}); err == nil {
+		t.Error("expected an error from a parser without a line parser")
+	}
+
+	failing := errors.New("bad options")
+	Register("registry_failing", func(options interface{}, settings Settings) Parser {
+		return &failingParser{err: failing}
+	}, testOptions{}, WithLineParser(func(p Parser) LineParser {
+		return nil
+	}))
+	if _, _, err := Lookup("registry_failing").NewLineParser(nil, Settings{}); err != failing {
+		t.Errorf("expected the error from Init, got %v", err)
+	}
+}
+
+type failingParser struct {
+	testParser
+	err error
+}
+
+func (p *failingParser) Init(options interface{}) error {
+	return p.err
+}
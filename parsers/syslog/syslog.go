@@ -1,6 +1,7 @@
 package syslog
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -23,10 +24,28 @@ type Options struct {
 	NumParsers  int    `hidden:"true" description:"number of parsers to spin up"`
 }
 
+func init() {
+	parsers.Register("syslog", func(options interface{}, settings parsers.Settings) parsers.Parser {
+		options.(*Options).NumParsers = settings.NumParsers
+		return &Parser{unparsed: settings.Unparsed}
+	}, Options{}, parsers.WithTitle("Syslog"), parsers.WithLineParser(func(p parsers.Parser) parsers.LineParser {
+		return p.(*Parser).lineParser
+	}), parsers.WithLineTimer(func(p parsers.Parser) parsers.LineTimer {
+		return func(parsed map[string]interface{}) (time.Time, bool) {
+			ts, ok := parsed["timestamp"].(time.Time)
+			if ok {
+				delete(parsed, "timestamp")
+			}
+			return ts, ok && !ts.IsZero()
+		}
+	}))
+}
+
 // Parser implements the Parser interface
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	unparsed   parsers.UnparsedFunc
 }
 
 // Init constructs our parser from the provided options
@@ -110,7 +129,7 @@ func (p *SyslogLineParser) ParseLine(line string) (map[string]interface{}, error
 	return logFields, nil
 }
 
-func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+func (p *Parser) ProcessLines(lines <-chan event.Line, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
 	// parse lines one by one
 	wg := sync.WaitGroup{}
 	numParsers := 1
@@ -120,7 +139,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
+			for rawLine := range lines {
+				line := rawLine.Text
 				logrus.WithFields(logrus.Fields{
 					"line": line,
 				}).Debug("attempting to process line")
@@ -134,7 +154,12 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				}
 
 				parsedLine, err := p.lineParser.ParseLine(line)
-				if parsedLine == nil || err != nil {
+				if err != nil {
+					p.unparsed.Report(rawLine, err)
+					continue
+				}
+				if parsedLine == nil {
+					// not one of the --syslog.processes
 					continue
 				}
 
@@ -142,6 +167,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					logrus.WithFields(logrus.Fields{
 						"line": line,
 					}).Info("skipping line, no values found")
+					p.unparsed.Report(rawLine, errors.New("no values found"))
 					continue
 				}
 
@@ -149,6 +175,10 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				for k, v := range prefixFields {
 					parsedLine[k] = v
 				}
+				// and anything known about where the line came from
+				for k, v := range rawLine.Fields {
+					parsedLine[k] = v
+				}
 
 				// the timestamp should be in the log file if we're following either rfc 3164 or 5424
 				var timestamp time.Time
@@ -160,6 +190,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 				e := event.Event{
 					Timestamp: timestamp,
 					Data:      parsedLine,
+					Source:    rawLine.Source,
+					Offset:    rawLine.Offset,
+					Dataset:   rawLine.Dataset,
 				}
 				send <- e
 			}
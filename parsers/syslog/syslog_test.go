@@ -177,11 +177,11 @@ func TestProcessLines(t *testing.T) {
 	})
 	assert.NoError(t, err, "Couldn't instantiate Parser")
 
-	lines := make(chan string)
+	lines := make(chan event.Line)
 	send := make(chan event.Event)
 	go func() {
 		for _, pair := range tlm {
-			lines <- pair.line
+			lines <- event.Line{Text: pair.line}
 		}
 		close(lines)
 	}()
@@ -194,3 +194,21 @@ func TestProcessLines(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessLinesFields(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{Mode: "rfc5424"})
+	assert.NoError(t, err, "Couldn't instantiate Parser")
+
+	lines := make(chan event.Line, 1)
+	send := make(chan event.Event, 1)
+	lines <- event.Line{
+		Text:   "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - hello",
+		Fields: map[string]interface{}{"sender_address": "10.0.0.1"},
+	}
+	close(lines)
+	p.ProcessLines(lines, send, nil)
+	ev := <-send
+	assert.Equal(t, "10.0.0.1", ev.Data["sender_address"])
+	assert.Equal(t, "hello", ev.Data["message"])
+}
@@ -0,0 +1,254 @@
+// Package pipeline reads lines from a source, parses them into events,
+// transforms the events and hands them to a sink. It's what honeytail runs
+// for each of its pipelines, and can be used to run honeytail's parsers from
+// inside another program.
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Source is where a pipeline gets its lines
+type Source interface {
+	// Lines starts reading and returns a channel of lines channels, one for
+	// each file or stream of lines, which is closed once no more will be
+	// added. Each lines channel gets a parser of its own. Cancelling ctx stops
+	// the reading, and the lines channels are closed once what's been read has
+	// been sent.
+	Lines(ctx context.Context) (chan chan event.Line, error)
+}
+
+// SourceFunc makes a function into a Source
+type SourceFunc func(ctx context.Context) (chan chan event.Line, error)
+
+// Lines calls f
+func (f SourceFunc) Lines(ctx context.Context) (chan chan event.Line, error) {
+	return f(ctx)
+}
+
+// Transform changes an event on its way from the parser to the sink. It drops
+// the event by setting its SampleRate to -1, after which no more transforms
+// are run on it. Transforms are run from several goroutines at once.
+type Transform interface {
+	Transform(ev *event.Event)
+}
+
+// TransformFunc makes a function into a Transform
+type TransformFunc func(ev *event.Event)
+
+// Transform calls f
+func (f TransformFunc) Transform(ev *event.Event) {
+	f(ev)
+}
+
+// Sink is where a pipeline's events end up
+type Sink interface {
+	// SendEvents sends the events read from events, returning once events is
+	// closed and all of them have been handed off. It's called once for each
+	// lines channel of the source, from a goroutine of its own. Events with a
+	// SampleRate of -1 have been dropped and mustn't be sent, but are still
+	// passed along so the sink knows they're done with.
+	SendEvents(events <-chan event.Event)
+}
+
+// Stats counts what has gone through a pipeline
+type Stats struct {
+	// Lines is how many lines were read from the source
+	Lines int64
+	// Events is how many events made from the lines got to the transforms
+	Events int64
+	// Dropped is how many of the events the transforms dropped
+	Dropped int64
+}
+
+// Pipeline parses the lines from Source into events, runs Transforms on each
+// of the events in order, then hands them to Sink
+type Pipeline struct {
+	Source Source
+	// NewParser returns an initialized parser. It's called for each lines
+	// channel from Source.
+	NewParser func() (parsers.Parser, error)
+	// PrefixRegex is passed to the parsers, to strip a prefix from each line
+	PrefixRegex *parsers.ExtRegexp
+	// Wrap, if set, is called with each lines channel from Source and the
+	// channel its parser sends events to. It returns the channels the parser
+	// reads lines from and the transforms read events from in their place.
+	// Unlike the transforms, it gets the events in the order they were parsed.
+	Wrap       func(lines chan event.Line, events chan event.Event) (chan event.Line, chan event.Event)
+	Transforms []Transform
+	Sink       Sink
+	// Workers is how many goroutines run the transforms for each lines
+	// channel. It defaults to 1.
+	Workers int
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	errLock sync.Mutex
+	err     error
+
+	lines   atomic.Int64
+	events  atomic.Int64
+	dropped atomic.Int64
+}
+
+// Start starts reading from the source, and returns any error doing so. The
+// pipeline runs until the source runs out of lines or ctx is cancelled.
+func (p *Pipeline) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	linesChans, err := p.Source.Lines(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	p.cancel = cancel
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		// new channels may keep arriving until ctx is cancelled
+		for lines := range linesChans {
+			p.wg.Add(1)
+			go func(lines chan event.Line) {
+				p.run(lines)
+				p.wg.Done()
+			}(lines)
+		}
+	}()
+	return nil
+}
+
+// Wait waits for the pipeline started with Start to hand all its events to
+// the sink. It returns the first error from NewParser, which stops the
+// pipeline. If Start failed or wasn't called, there's nothing to wait for.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+	return p.err
+}
+
+// Stop stops reading from the source, then waits for the lines already read
+// to get to the sink, the same as Wait
+func (p *Pipeline) Stop() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return p.Wait()
+}
+
+// Stats returns what has gone through the pipeline so far
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Lines:   p.lines.Load(),
+		Events:  p.events.Load(),
+		Dropped: p.dropped.Load(),
+	}
+}
+
+// fail records err and stops the pipeline
+func (p *Pipeline) fail(err error) {
+	p.errLock.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.errLock.Unlock()
+	p.cancel()
+}
+
+// run parses one lines channel and sends its events, returning once they've
+// all been handed to the sink
+func (p *Pipeline) run(lines chan event.Line) {
+	parser, err := p.NewParser()
+	if err != nil {
+		p.fail(err)
+		// the source stops once cancelled, so there's not much left to read
+		for range lines {
+		}
+		return
+	}
+
+	counted := make(chan event.Line)
+	go func() {
+		defer close(counted)
+		for line := range lines {
+			p.lines.Add(1)
+			counted <- line
+		}
+	}()
+	workers := p.workers()
+	toBeSent := make(chan event.Event, workers)
+	plines, parsed := counted, toBeSent
+	if p.Wrap != nil {
+		plines, parsed = p.Wrap(counted, toBeSent)
+	}
+	transformed := applyTransforms(parsed, p.Transforms, workers, p)
+
+	doneSending := make(chan struct{})
+	go func() {
+		p.Sink.SendEvents(transformed)
+		close(doneSending)
+	}()
+	// ProcessLines won't return until lines is closed
+	parser.ProcessLines(plines, toBeSent, p.PrefixRegex)
+	// trigger the sink to finish up
+	close(toBeSent)
+	<-doneSending
+}
+
+func (p *Pipeline) workers() int {
+	if p.Workers < 1 {
+		return 1
+	}
+	return p.Workers
+}
+
+// ApplyTransforms runs transforms on each event read from events, in order,
+// using workers goroutines. It returns a channel of the transformed events,
+// which is closed once events is closed and they've all been transformed.
+func ApplyTransforms(events chan event.Event, transforms []Transform, workers int) chan event.Event {
+	if workers < 1 {
+		workers = 1
+	}
+	return applyTransforms(events, transforms, workers, nil)
+}
+
+// applyTransforms is ApplyTransforms, counting the events in the stats of p
+// if it's set
+func applyTransforms(events chan event.Event, transforms []Transform, workers int, p *Pipeline) chan event.Event {
+	transformed := make(chan event.Event, 10*workers)
+	go func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ev := range events {
+					for _, t := range transforms {
+						t.Transform(&ev)
+						if ev.SampleRate == -1 {
+							break
+						}
+					}
+					if p != nil {
+						p.events.Add(1)
+						if ev.SampleRate == -1 {
+							p.dropped.Add(1)
+						}
+					}
+					transformed <- ev
+				}
+			}()
+		}
+		wg.Wait()
+		close(transformed)
+	}()
+	return transformed
+}
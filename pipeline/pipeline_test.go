@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+	"github.com/honeycombio/honeytail/parsers/htjson"
+)
+
+type testSink struct {
+	sync.Mutex
+	events []event.Event
+}
+
+func (s *testSink) SendEvents(events <-chan event.Event) {
+	for ev := range events {
+		s.Lock()
+		s.events = append(s.events, ev)
+		s.Unlock()
+	}
+}
+
+func newJSONParser() (parsers.Parser, error) {
+	parser := &htjson.Parser{}
+	return parser, parser.Init(&htjson.Options{NumParsers: 1})
+}
+
+// linesSource sends each of files as a lines channel
+func linesSource(files map[string][]string) Source {
+	return SourceFunc(func(ctx context.Context) (chan chan event.Line, error) {
+		linesChans := make(chan chan event.Line, len(files))
+		for source, texts := range files {
+			lines := make(chan event.Line)
+			go func(source string, texts []string) {
+				defer close(lines)
+				for _, text := range texts {
+					lines <- event.Line{Text: text, Source: source}
+				}
+			}(source, texts)
+			linesChans <- lines
+		}
+		close(linesChans)
+		return linesChans, nil
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	sink := &testSink{}
+	p := &Pipeline{
+		Source: linesSource(map[string][]string{
+			"a.log": {`{"user":"pikachu"}`, `{"user":"bulbasaur"}`},
+			"b.log": {`{"user":"squirtle"}`},
+		}),
+		NewParser: newJSONParser,
+		Transforms: []Transform{
+			TransformFunc(func(ev *event.Event) {
+				ev.Data["seen"] = true
+				if ev.Data["user"] == "bulbasaur" {
+					ev.SampleRate = -1
+				}
+			}),
+			TransformFunc(func(ev *event.Event) {
+				ev.Data["source"] = ev.Source
+			}),
+		},
+		Sink:    sink,
+		Workers: 3,
+	}
+	assert.Nil(t, p.Start(context.Background()))
+	assert.Nil(t, p.Wait())
+
+	assert.Equal(t, Stats{Lines: 3, Events: 3, Dropped: 1}, p.Stats())
+	sort.Slice(sink.events, func(i, j int) bool {
+		return sink.events[i].Data["user"].(string) < sink.events[j].Data["user"].(string)
+	})
+	assert.Len(t, sink.events, 3)
+	// transforms after the one that dropped the event aren't run
+	assert.Equal(t, map[string]interface{}{"user": "bulbasaur", "seen": true}, sink.events[0].Data)
+	assert.Equal(t, -1, sink.events[0].SampleRate)
+	assert.Equal(t, map[string]interface{}{"user": "pikachu", "seen": true, "source": "a.log"}, sink.events[1].Data)
+	assert.Equal(t, map[string]interface{}{"user": "squirtle", "seen": true, "source": "b.log"}, sink.events[2].Data)
+}
+
+func TestPipelineWrap(t *testing.T) {
+	sink := &testSink{}
+	var order []string
+	p := &Pipeline{
+		Source:    linesSource(map[string][]string{"a.log": {`{"n":"1"}`, `{"n":"2"}`, `{"n":"3"}`}}),
+		NewParser: newJSONParser,
+		Wrap: func(lines chan event.Line, events chan event.Event) (chan event.Line, chan event.Event) {
+			ordered := make(chan event.Event)
+			go func() {
+				defer close(ordered)
+				for ev := range events {
+					order = append(order, ev.Data["n"].(string))
+					ordered <- ev
+				}
+			}()
+			return lines, ordered
+		},
+		Sink:    sink,
+		Workers: 4,
+	}
+	assert.Nil(t, p.Start(context.Background()))
+	assert.Nil(t, p.Wait())
+	assert.Equal(t, []string{"1", "2", "3"}, order)
+	assert.Len(t, sink.events, 3)
+}
+
+func TestPipelineStop(t *testing.T) {
+	sink := &testSink{}
+	p := &Pipeline{
+		// a source that keeps sending lines until it's cancelled
+		Source: SourceFunc(func(ctx context.Context) (chan chan event.Line, error) {
+			lines := make(chan event.Line)
+			go func() {
+				defer close(lines)
+				for {
+					select {
+					case lines <- event.Line{Text: `{"tick":true}`}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			linesChans := make(chan chan event.Line, 1)
+			linesChans <- lines
+			close(linesChans)
+			return linesChans, nil
+		}),
+		NewParser: newJSONParser,
+		Sink:      sink,
+	}
+	assert.Nil(t, p.Start(context.Background()))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, p.Stop())
+	stats := p.Stats()
+	assert.NotZero(t, stats.Lines)
+	assert.Equal(t, stats.Events, int64(len(sink.events)))
+}
+
+func TestPipelineErrors(t *testing.T) {
+	failing := errors.New("no such file")
+	p := &Pipeline{
+		Source: SourceFunc(func(ctx context.Context) (chan chan event.Line, error) {
+			return nil, failing
+		}),
+	}
+	assert.Equal(t, failing, p.Start(context.Background()))
+	// a pipeline that didn't start has nothing to stop
+	assert.Nil(t, p.Stop())
+
+	p = &Pipeline{
+		Source: linesSource(map[string][]string{"a.log": {`{}`}}),
+		NewParser: func() (parsers.Parser, error) {
+			return nil, failing
+		},
+		Sink: &testSink{},
+	}
+	assert.Nil(t, p.Start(context.Background()))
+	assert.Equal(t, failing, p.Wait())
+}
+
+func TestApplyTransforms(t *testing.T) {
+	events := make(chan event.Event)
+	transformed := ApplyTransforms(events, []Transform{
+		TransformFunc(func(ev *event.Event) { ev.Data["a"] = 1 }),
+		TransformFunc(func(ev *event.Event) { ev.Data["b"] = ev.Data["a"] }),
+	}, 0)
+	events <- event.Event{Data: map[string]interface{}{}}
+	close(events)
+	ev := <-transformed
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 1}, ev.Data)
+	_, ok := <-transformed
+	assert.False(t, ok)
+}
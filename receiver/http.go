@@ -0,0 +1,225 @@
+package receiver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// maxHTTPBodyBytes is the largest request body accepted
+const maxHTTPBodyBytes = 10 * 1024 * 1024
+
+// httpShutdownTimeout is how long connections get to finish up once it's time
+// to stop
+var httpShutdownTimeout = 5 * time.Second
+
+type HTTPOptions struct {
+	Routes     []string `long:"route" description:"Path that accepts POSTed log lines, optionally followed by a query string. A dataset parameter sends the route's events to that dataset instead of --dataset, and any other parameters are added to its events as fields, eg. '/jobs?dataset=batch-jobs&team=infra'. May have multiple values. Defaults to /." yaml:"route,omitempty"`
+	QueueLines uint     `long:"queue_lines" description:"Number of lines waiting to be parsed before requests are turned away with 429 Too Many Requests." default:"10000" yaml:"queue_lines"`
+}
+
+// Route is a path that accepts log lines, along with what to add to the events
+// made from them
+type Route struct {
+	Path string
+	// Dataset is empty to use the configured dataset
+	Dataset string
+	Fields  map[string]interface{}
+}
+
+// ParseRoute parses the value of --http.route
+func ParseRoute(spec string) (Route, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return Route{}, fmt.Errorf("can't parse route %s: %s", spec, err)
+	}
+	if !strings.HasPrefix(u.Path, "/") || u.Host != "" {
+		return Route{}, fmt.Errorf("route %s must be a path starting with /", spec)
+	}
+	route := Route{Path: u.Path}
+	for key, values := range u.Query() {
+		value := values[len(values)-1]
+		if key == "dataset" {
+			route.Dataset = value
+			continue
+		}
+		if route.Fields == nil {
+			route.Fields = make(map[string]interface{})
+		}
+		route.Fields[key] = value
+	}
+	return route, nil
+}
+
+// ListenHTTP runs an HTTP server on addr that accepts newline delimited log
+// lines POSTed to any of options.Routes. It returns a channel that gets all the
+// lines, and the address it's listening on.
+//
+// The lines from one request are queued together or not at all; when there
+// isn't room for them the request gets 429 Too Many Requests and can be tried
+// again later. The lines channel is closed once ctx is cancelled and the
+// requests in flight have finished.
+func ListenHTTP(ctx context.Context, addr string, options HTTPOptions) (chan event.Line, net.Addr, error) {
+	specs := options.Routes
+	if len(specs) == 0 {
+		specs = []string{"/"}
+	}
+	queueLines := int(options.QueueLines)
+	if queueLines < 1 {
+		queueLines = 1
+	}
+	lines := make(chan event.Line, queueLines)
+	mux := http.NewServeMux()
+	queue := &lineQueue{lines: lines}
+	for _, spec := range specs {
+		route, err := ParseRoute(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		mux.Handle(route.Path, &routeHandler{route: route, queue: queue})
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.WithError(err).Error("HTTP input server stopped")
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		// stop taking new connections and close the idle ones. Connections
+		// that are open but haven't sent a request yet can hold up Shutdown,
+		// so don't wait for it; requests that start from here on are turned
+		// away instead.
+		go func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				server.Close()
+			}
+		}()
+		queue.close()
+	}()
+	return lines, listener.Addr(), nil
+}
+
+// lineQueue adds all the lines from a request to the lines channel at once, so
+// lines from different requests don't get mixed together
+type lineQueue struct {
+	lock     sync.Mutex
+	lines    chan event.Line
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// errQueueFull is returned when there isn't room for all of a request's lines
+var errQueueFull = errors.New("queue full")
+
+// start records that a request is being handled. It returns false if the
+// queue has been closed.
+func (q *lineQueue) start() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return false
+	}
+	q.inFlight.Add(1)
+	return true
+}
+
+// finish records that a request is done
+func (q *lineQueue) finish() {
+	q.inFlight.Done()
+}
+
+// add queues all of lines if there's room for them
+func (q *lineQueue) add(lines []event.Line) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	// only the parser takes lines off the channel while the lock is held, so
+	// there's at least as much room as this by the time they're added
+	if cap(q.lines)-len(q.lines) < len(lines) {
+		return errQueueFull
+	}
+	for _, line := range lines {
+		q.lines <- line
+	}
+	return nil
+}
+
+// close stops new requests from starting, then closes the lines channel once
+// the ones in flight are done
+func (q *lineQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+	q.inFlight.Wait()
+	close(q.lines)
+}
+
+type routeHandler struct {
+	route Route
+	queue *lineQueue
+}
+
+func (h *routeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.queue.start() {
+		http.Error(w, "honeytail is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.queue.finish()
+	var lines []event.Line
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, maxHTTPBodyBytes))
+	scanner.Buffer(make([]byte, 64*1024), maxHTTPBodyBytes)
+	for scanner.Scan() {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		lines = append(lines, event.Line{
+			Text:    text,
+			Fields:  h.route.Fields,
+			Dataset: h.route.Dataset,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(lines) > cap(h.queue.lines) {
+		http.Error(w, fmt.Sprintf("too many lines in one request; the limit is %d", cap(h.queue.lines)),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := h.queue.add(lines); err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "honeytail is busy, try again later", http.StatusTooManyRequests)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
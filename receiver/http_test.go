@@ -0,0 +1,90 @@
+package receiver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseRoute(t *testing.T) {
+	route, err := ParseRoute("/jobs?dataset=batch-jobs&team=infra")
+	assert.NoError(t, err)
+	assert.Equal(t, Route{
+		Path:    "/jobs",
+		Dataset: "batch-jobs",
+		Fields:  map[string]interface{}{"team": "infra"},
+	}, route)
+
+	route, err = ParseRoute("/")
+	assert.NoError(t, err)
+	assert.Equal(t, Route{Path: "/"}, route)
+
+	_, err = ParseRoute("jobs")
+	assert.Error(t, err)
+	_, err = ParseRoute("http://example.com/jobs")
+	assert.Error(t, err)
+}
+
+func post(t *testing.T, url, body string) int {
+	t.Helper()
+	rsp, err := http.Post(url, "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	return rsp.StatusCode
+}
+
+func TestListenHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, addr, err := ListenHTTP(ctx, "127.0.0.1:0", HTTPOptions{
+		Routes:     []string{"/", "/jobs?dataset=batch-jobs&team=infra"},
+		QueueLines: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + addr.String()
+
+	assert.Equal(t, http.StatusAccepted, post(t, url+"/", "{\"a\":1}\n\n{\"b\":2}"))
+	assert.Equal(t, event.Line{Text: `{"a":1}`}, <-lines)
+	assert.Equal(t, event.Line{Text: `{"b":2}`}, <-lines)
+
+	assert.Equal(t, http.StatusAccepted, post(t, url+"/jobs", "{\"c\":3}\r\n"))
+	assert.Equal(t, event.Line{
+		Text:    `{"c":3}`,
+		Dataset: "batch-jobs",
+		Fields:  map[string]interface{}{"team": "infra"},
+	}, <-lines)
+
+	// a request's lines are all queued or none of them are
+	assert.Equal(t, http.StatusAccepted, post(t, url+"/", "1\n2"))
+	assert.Equal(t, http.StatusTooManyRequests, post(t, url+"/", "3\n4"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(t, url+"/", "1\n2\n3\n4"))
+	assert.Equal(t, "1", (<-lines).Text)
+	assert.Equal(t, "2", (<-lines).Text)
+	assert.Equal(t, http.StatusAccepted, post(t, url+"/", "3\n4"))
+	assert.Equal(t, "3", (<-lines).Text)
+	assert.Equal(t, "4", (<-lines).Text)
+
+	rsp, err := http.Get(url + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, rsp.StatusCode)
+
+	cancel()
+	select {
+	case _, ok := <-lines:
+		assert.False(t, ok, "expected the lines channel to be closed")
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the lines channel to close")
+	}
+}
@@ -0,0 +1,255 @@
+// Package receiver accepts log lines sent to honeytail over the network
+// rather than read from files.
+package receiver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// SenderAddressField is the field that gets the address of the host a
+// message was received from
+const SenderAddressField = "sender_address"
+
+// maxSyslogMessageBytes is the longest message accepted, which is also the
+// largest UDP datagram
+const maxSyslogMessageBytes = 64 * 1024
+
+// truncatedMessages has how many newline terminated messages from each sender
+// have been cut short for being longer than maxSyslogMessageBytes
+var truncatedMessages = struct {
+	sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// TruncatedMessages returns how many syslog messages from each sender address
+// have been truncated for being longer than 64KiB since honeytail started.
+func TruncatedMessages() map[string]int64 {
+	truncatedMessages.Lock()
+	defer truncatedMessages.Unlock()
+	counts := make(map[string]int64, len(truncatedMessages.counts))
+	for sender, n := range truncatedMessages.counts {
+		counts[sender] = n
+	}
+	return counts
+}
+
+// ListenSyslog listens for syslog messages on addr over both UDP and TCP. It
+// returns a channel that gets each message as a line with the sender's address
+// in its Fields, and the address it's listening on. When addr has port 0, UDP
+// listens on the same port TCP was given.
+//
+// Each UDP datagram is one message. TCP connections can mix octet counted
+// messages ("<length> <message>") and newline terminated ones, as described in
+// RFC 6587. The lines channel is closed once ctx is cancelled and all the
+// connections have been closed.
+func ListenSyslog(ctx context.Context, addr string) (chan event.Line, net.Addr, error) {
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	udp, err := net.ListenPacket("udp", tcp.Addr().String())
+	if err != nil {
+		tcp.Close()
+		return nil, nil, err
+	}
+
+	lines := make(chan event.Line)
+	r := &syslogReceiver{
+		lines: lines,
+		conns: make(map[net.Conn]struct{}),
+	}
+	r.wg.Add(2)
+	go r.readPackets(udp)
+	go r.accept(tcp)
+	go func() {
+		<-ctx.Done()
+		udp.Close()
+		tcp.Close()
+		r.closeConns()
+	}()
+	go func() {
+		r.wg.Wait()
+		close(lines)
+	}()
+	return lines, tcp.Addr(), nil
+}
+
+// syslogReceiver keeps track of the open connections so they can be closed
+// when it's time to stop
+type syslogReceiver struct {
+	lines chan event.Line
+	wg    sync.WaitGroup
+
+	lock   sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// send passes one message along as a line
+func (r *syslogReceiver) send(msg string, from net.Addr) {
+	// some senders terminate messages with a newline or NUL even when they
+	// don't need to
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if msg == "" {
+		return
+	}
+	r.lines <- event.Line{
+		Text:   msg,
+		Fields: map[string]interface{}{SenderAddressField: senderAddress(from)},
+	}
+}
+
+// senderAddress returns the host part of addr; the port a message was sent
+// from doesn't mean much
+func senderAddress(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func (r *syslogReceiver) readPackets(conn net.PacketConn) {
+	defer r.wg.Done()
+	buf := make([]byte, maxSyslogMessageBytes)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.WithError(err).Error("Failed to read syslog message over UDP")
+			}
+			return
+		}
+		r.send(string(buf[:n]), from)
+	}
+}
+
+func (r *syslogReceiver) accept(listener net.Listener) {
+	defer r.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logrus.WithError(err).Error("Failed to accept syslog connection")
+			}
+			return
+		}
+		if !r.addConn(conn) {
+			conn.Close()
+			return
+		}
+		r.wg.Add(1)
+		go r.readStream(conn)
+	}
+}
+
+// addConn records an open connection. It returns false if the receiver has
+// already been told to stop.
+func (r *syslogReceiver) addConn(conn net.Conn) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	return true
+}
+
+func (r *syslogReceiver) closeConns() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func (r *syslogReceiver) readStream(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.lock.Lock()
+		delete(r.conns, conn)
+		r.lock.Unlock()
+		conn.Close()
+	}()
+	err := readSyslogFrames(bufio.NewReader(conn), func(msg string, truncated bool) {
+		if truncated {
+			truncatedMessages.Lock()
+			truncatedMessages.counts[senderAddress(conn.RemoteAddr())]++
+			truncatedMessages.Unlock()
+		}
+		r.send(msg, conn.RemoteAddr())
+	})
+	if err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+		logrus.WithError(err).WithField(SenderAddressField, senderAddress(conn.RemoteAddr())).
+			Warn("Closing syslog connection")
+	}
+}
+
+// readSyslogFrames reads messages from a stream until it ends, handing each
+// one to send. A message that starts with a digit is octet counted, anything
+// else runs to the end of the line. Lines longer than maxSyslogMessageBytes
+// are truncated, which send is told about, so that a sender that never ends
+// its line can't use up all the memory.
+func readSyslogFrames(r *bufio.Reader, send func(msg string, truncated bool)) error {
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if first[0] < '1' || first[0] > '9' {
+			msg, truncated, err := readSyslogLine(r)
+			send(msg, truncated)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// ReadSlice fails if the length goes on for longer than the buffer
+		length, err := r.ReadSlice(' ')
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(string(length), " "))
+		if err != nil || n > maxSyslogMessageBytes {
+			return fmt.Errorf("invalid syslog message length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return err
+		}
+		send(string(msg), false)
+	}
+}
+
+// readSyslogLine reads up to the next '\n', keeping no more than
+// maxSyslogMessageBytes of the message and its '\n'. It returns whether any
+// more was thrown away, and like bufio.Reader.ReadString, what was read along
+// with any error.
+func readSyslogLine(r *bufio.Reader) (string, bool, error) {
+	var msg []byte
+	truncated := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if room := maxSyslogMessageBytes + 1 - len(msg); len(chunk) > room {
+			chunk = chunk[:room]
+			truncated = true
+		}
+		msg = append(msg, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(msg), truncated, err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package receiver
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const (
+	rfc5424Message = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - An application event log entry...`
+	rfc3164Message = `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`
+)
+
+func expectMessage(t *testing.T, lines chan event.Line, msg string) {
+	t.Helper()
+	select {
+	case line := <-lines:
+		assert.Equal(t, msg, line.Text)
+		assert.Equal(t, "127.0.0.1", line.Fields[SenderAddressField])
+		assert.Equal(t, "", line.Source)
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for %q", msg)
+	}
+}
+
+func TestListenSyslogUDP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines, addr, err := ListenSyslog(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(rfc5424Message))
+	expectMessage(t, lines, rfc5424Message)
+	conn.Write([]byte(rfc3164Message + "\n"))
+	expectMessage(t, lines, rfc3164Message)
+}
+
+func TestListenSyslogTCP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, addr, err := ListenSyslog(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	multiline := rfc5424Message + "\nwith a second line"
+	conn.Write([]byte(rfc3164Message + "\n" + rfc5424Message + "\r\n"))
+	conn.Write([]byte(strconv.Itoa(len(multiline)) + " " + multiline[:20]))
+	conn.Write([]byte(multiline[20:] + rfc3164Message + "\n"))
+	expectMessage(t, lines, rfc3164Message)
+	expectMessage(t, lines, rfc5424Message)
+	expectMessage(t, lines, multiline)
+	expectMessage(t, lines, rfc3164Message)
+
+	// cancelling closes the open connection as well as the listeners
+	cancel()
+	select {
+	case _, ok := <-lines:
+		assert.False(t, ok, "expected the lines channel to be closed")
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for the lines channel to close")
+	}
+}
+
+func TestReadSyslogFrames(t *testing.T) {
+	var msgs []string
+	err := readSyslogFrames(bufio.NewReader(strings.NewReader("3 abc5 de\nfg\nhij\n12 short")), func(msg string, truncated bool) {
+		assert.False(t, truncated)
+		msgs = append(msgs, msg)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"abc", "de\nfg", "\n", "hij\n"}, msgs)
+
+	msgs = nil
+	err = readSyslogFrames(bufio.NewReader(strings.NewReader("<1>no newline")), func(msg string, truncated bool) {
+		msgs = append(msgs, msg)
+	})
+	assert.Equal(t, []string{"<1>no newline"}, msgs)
+	assert.Error(t, err)
+
+	// newline terminated messages are cut off at the longest message allowed
+	long := "<1>" + strings.Repeat("x", maxSyslogMessageBytes)
+	var truncated []bool
+	msgs = nil
+	err = readSyslogFrames(bufio.NewReader(strings.NewReader(long+"\n<2>short\n")), func(msg string, t bool) {
+		msgs = append(msgs, msg)
+		truncated = append(truncated, t)
+	})
+	assert.Equal(t, []string{long[:maxSyslogMessageBytes+1], "<2>short\n"}, msgs)
+	assert.Equal(t, []bool{true, false}, truncated)
+	assert.Equal(t, io.EOF, err)
+
+	// a length that goes on and on is an error
+	err = readSyslogFrames(bufio.NewReader(strings.NewReader(strings.Repeat("1", 10000)+" x")), func(string, bool) {
+		assert.Fail(t, "shouldn't get a message")
+	})
+	assert.Error(t, err)
+}
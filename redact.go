@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// detector finds one kind of sensitive value in strings, for --redact
+type detector struct {
+	name  string
+	regex *regexp.Regexp
+	// valid checks a match of regex, if the regex alone can't tell
+	valid func(s string) bool
+	// locate finds the values in a match of regex, if the match isn't one
+	// value. It returns where each starts and ends in the match.
+	locate func(s string) [][2]int
+}
+
+// detectors are the built in detectors of --redact, by name
+var detectors = map[string]detector{
+	"email": {
+		regex: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	// card numbers, with or without spaces or dashes between the digits.
+	// There can be other numbers right next to one, like a CVV or a count,
+	// so they're looked for in runs of digits of any length.
+	"pan": {
+		regex:  regexp.MustCompile(`\b\d(?:[ \-]?\d){12,}\b`),
+		locate: findCardNumbers,
+	},
+	"ipv4": {
+		regex: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+	},
+	// the candidates are checked with net.ParseIP, which rules out times and
+	// MAC addresses. They can't follow a letter or digit, so the :: of eg.
+	// std::string isn't one.
+	"ipv6": {
+		regex: regexp.MustCompile(`(?:^|[^0-9A-Za-z:.])((?:[0-9A-Fa-f]{0,4}:){2,7}(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(?:\.(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)){3}|[0-9A-Fa-f]{0,4}))`),
+		valid: func(s string) bool {
+			return len(s) > 2 && net.ParseIP(s) != nil
+		},
+	},
+	"jwt": {
+		regex: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	},
+	// access key IDs, and secret keys given next to a name saying they are one
+	"aws_key": {
+		regex: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b|(?i:aws)[\w.\-]{0,20}(?i:secret)[\w.\-]{0,20}["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`),
+	},
+	"bearer": {
+		regex: regexp.MustCompile(`(?i:bearer)\s+([A-Za-z0-9\-._~+/]+=*)`),
+	},
+}
+
+// detectorNames lists the built in detectors, for messages
+const detectorNames = "email, pan, ipv4, ipv6, jwt, aws_key or bearer"
+
+// redactor replaces what its detectors find in string fields, for --redact
+type redactor struct {
+	detectors []detector
+	// fields are the fields to look in. Empty means all of them.
+	fields []string
+	// hashKey, if set, replaces matches with a hash keyed with it instead of
+	// just the name of their detector
+	hashKey []byte
+}
+
+// newRedactor parses --redact. It returns nil if there's nothing to redact.
+func newRedactor(options GlobalOptions) (*redactor, error) {
+	if len(options.Redact) == 0 {
+		return nil, nil
+	}
+	r := &redactor{fields: options.RedactFields}
+	if options.RedactHashKey != "" {
+		r.hashKey = []byte(options.RedactHashKey)
+	}
+	seen := make(map[string]bool)
+	for _, name := range options.Redact {
+		var d detector
+		if splitName := strings.SplitN(name, "=", 2); len(splitName) == 2 {
+			if splitName[0] == "" {
+				return nil, fmt.Errorf("unable to separate --redact %s into a name=regex pair", name)
+			}
+			re, err := regexp.Compile(splitName[1])
+			if err != nil {
+				return nil, fmt.Errorf("unable to compile the regex of --redact %s: %v", name, err)
+			}
+			d = detector{name: splitName[0], regex: re}
+		} else {
+			var ok bool
+			d, ok = detectors[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown detector in --redact %s, should be one of %s, or name=regex", name, detectorNames)
+			}
+			d.name = name
+		}
+		if seen[d.name] {
+			return nil, fmt.Errorf("more than one --redact is named %s", d.name)
+		}
+		seen[d.name] = true
+		r.detectors = append(r.detectors, d)
+	}
+	return r, nil
+}
+
+// match is a part of a string a detector found
+type match struct {
+	start, end int
+	detector   int
+}
+
+// redact replaces what the detectors find in s. Where they find overlapping
+// parts, the one found first in s wins, then the one listed first. It returns
+// how many parts it replaced for each detector.
+func (r *redactor) redact(s string) (string, map[string]int64) {
+	var matches []match
+	for i, d := range r.detectors {
+		for _, loc := range d.regex.FindAllStringSubmatchIndex(s, -1) {
+			// with a group, only what it matches is redacted
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start == end || (d.valid != nil && !d.valid(s[start:end])) {
+				continue
+			}
+			if d.locate != nil {
+				for _, value := range d.locate(s[start:end]) {
+					matches = append(matches, match{start: start + value[0], end: start + value[1], detector: i})
+				}
+				continue
+			}
+			matches = append(matches, match{start: start, end: end, detector: i})
+		}
+	}
+	if len(matches) == 0 {
+		return s, nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].detector < matches[j].detector
+	})
+	var b strings.Builder
+	counts := make(map[string]int64)
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		name := r.detectors[m.detector].name
+		b.WriteString(s[last:m.start])
+		b.WriteString(r.replacement(name, s[m.start:m.end]))
+		counts[name]++
+		last = m.end
+	}
+	b.WriteString(s[last:])
+	return b.String(), counts
+}
+
+// replacement is what replaces value found by the detector name
+func (r *redactor) replacement(name, value string) string {
+	if r.hashKey == nil {
+		return "[REDACTED:" + name + "]"
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	// the same value always gets the same hash, so it can still be grouped by
+	return fmt.Sprintf("[REDACTED:%s:%x]", name, mac.Sum(nil)[:8])
+}
+
+// apply redacts the strings in ev, including those in nested objects and
+// lists, counting the redactions in stats
+func (r *redactor) apply(ev *event.Event, stats *responseStats) {
+	if len(r.fields) == 0 {
+		r.redactValue(ev.Data, stats)
+		return
+	}
+	for _, field := range r.fields {
+		r.redactField(ev.Data, field, stats)
+	}
+}
+
+// redactField redacts the value of field in data. A field with dots in its
+// name that isn't in data is looked for in the objects it holds, eg.
+// user.email is the email of the user object, or of each object in a user
+// list.
+func (r *redactor) redactField(data map[string]interface{}, field string, stats *responseStats) {
+	if val, ok := data[field]; ok {
+		data[field] = r.redactValue(val, stats)
+		return
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		switch nested := data[field[:i]].(type) {
+		case map[string]interface{}:
+			r.redactField(nested, field[i+1:], stats)
+			return
+		case []interface{}:
+			for _, elem := range nested {
+				if m, ok := elem.(map[string]interface{}); ok {
+					r.redactField(m, field[i+1:], stats)
+				}
+			}
+			return
+		}
+	}
+}
+
+// redactValue returns v redacted, if it's a string. The strings in objects
+// and lists are redacted in place.
+func (r *redactor) redactValue(v interface{}, stats *responseStats) interface{} {
+	switch v := v.(type) {
+	case string:
+		redacted, counts := r.redact(v)
+		if counts != nil {
+			stats.countRedactions(counts)
+		}
+		return redacted
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = r.redactValue(val, stats)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = r.redactValue(val, stats)
+		}
+	}
+	return v
+}
+
+// findCardNumbers finds the card numbers in s, a run of digits split into
+// groups by spaces or dashes. A card number is some whole groups with 13 to 19
+// digits between them that pass the Luhn check, the longest one there is
+// where there's a choice.
+func findCardNumbers(s string) [][2]int {
+	// where each group of digits starts and ends
+	var groups [][2]int
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '-' {
+			groups = append(groups, [2]int{start, i})
+			start = i + 1
+		}
+	}
+	var found [][2]int
+	for first := 0; first < len(groups); first++ {
+		end := -1
+		digits := 0
+		for last := first; last < len(groups); last++ {
+			digits += groups[last][1] - groups[last][0]
+			if digits > 19 {
+				break
+			}
+			if luhn(s[groups[first][0]:groups[last][1]]) {
+				end = last
+			}
+		}
+		if end >= 0 {
+			found = append(found, [2]int{groups[first][0], groups[end][1]})
+			first = end
+		}
+	}
+	return found
+}
+
+// luhn checks the digits in s add up as the digits of a card number should
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
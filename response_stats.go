@@ -1,11 +1,14 @@
 package main
 
 import (
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/receiver"
+	"github.com/honeycombio/honeytail/tail"
 	"github.com/honeycombio/libhoney-go/transmission"
 	"github.com/sirupsen/logrus"
 )
@@ -19,6 +22,9 @@ import (
 type responseStats struct {
 	lock *sync.Mutex
 
+	// pipeline is the name of the pipeline the stats are for, if it has one
+	pipeline string
+
 	count       int
 	statusCodes map[int]int
 	bodies      map[string]int
@@ -30,12 +36,40 @@ type responseStats struct {
 
 	totalCount       int
 	totalStatusCodes map[int]int
+
+	// newest is the timestamp of the newest event sent from each file, to
+	// tell how far behind tailing it is
+	newest map[string]time.Time
+	// lagWarningBytes and lagWarningSeconds are how far behind a file can get
+	// before logging a warning. 0 means never.
+	lagWarningBytes   int64
+	lagWarningSeconds uint
+	// noSecondsBehind leaves out seconds_behind when event timestamps don't
+	// say how old the lines being read are, with --rebase_time or backfilling
+	noSecondsBehind bool
+	// files are the --file patterns of the pipeline, to tell which tailed
+	// files are its own before they've sent any events
+	files []string
+
+	// unparsedLines is how many lines each parser has failed to parse since
+	// honeytail started
+	unparsedLines map[string]int64
+	// fieldTypeErrors is how many values of each --field_type field have
+	// failed to convert since honeytail started
+	fieldTypeErrors map[string]int64
+	// redactions is how many values each --redact detector has redacted
+	// since honeytail started
+	redactions map[string]int64
 }
 
 // newResponseStats initializes the struct's complex data types
 func newResponseStats() *responseStats {
 	r := &responseStats{}
 	r.totalStatusCodes = make(map[int]int)
+	r.newest = make(map[string]time.Time)
+	r.unparsedLines = make(map[string]int64)
+	r.fieldTypeErrors = make(map[string]int64)
+	r.redactions = make(map[string]int64)
 	r.lock = &sync.Mutex{}
 	r.reset()
 	return r
@@ -62,6 +96,33 @@ func (r *responseStats) update(rsp transmission.Response) {
 	r.sumDuration += rsp.Duration
 	ev := rsp.Metadata.(event.Event)
 	r.event = &ev
+	if ev.Source != "" && ev.Timestamp.After(r.newest[ev.Source]) {
+		r.newest[ev.Source] = ev.Timestamp
+	}
+}
+
+// countUnparsed counts a line that parser failed to parse
+func (r *responseStats) countUnparsed(parser string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.unparsedLines[parser]++
+}
+
+// countFieldTypeError counts a value of field that failed to convert to its
+// --field_type
+func (r *responseStats) countFieldTypeError(field string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.fieldTypeErrors[field]++
+}
+
+// countRedactions adds how many values each --redact detector redacted
+func (r *responseStats) countRedactions(counts map[string]int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for name, n := range counts {
+		r.redactions[name] += n
+	}
 }
 
 // log the current stats and reset them all to zero.
@@ -82,7 +143,33 @@ func (r *responseStats) log() {
 	} else {
 		avg = 0
 	}
-	logrus.WithFields(logrus.Fields{
+	bytesBehind := tail.BytesBehind()
+	invalidBytes := tail.InvalidBytes()
+	truncatedLines, droppedLines := tail.LongLines()
+	if r.pipeline != "" {
+		// other pipelines report on the files they're reading
+		for _, counts := range []map[string]int64{bytesBehind, invalidBytes, truncatedLines, droppedLines} {
+			for file := range counts {
+				if !r.reads(file) {
+					delete(counts, file)
+				}
+			}
+		}
+	}
+	secondsBehind := make(map[string]int64)
+	if !r.noSecondsBehind {
+		for file, bytes := range bytesBehind {
+			if newest, ok := r.newest[file]; ok {
+				if bytes == 0 {
+					// caught up, however long ago the last event was
+					secondsBehind[file] = 0
+				} else {
+					secondsBehind[file] = int64(time.Since(newest) / time.Second)
+				}
+			}
+		}
+	}
+	fields := logrus.Fields{
 		"count":            r.count,
 		"lifetime_count":   r.totalCount + r.count,
 		"slowest":          r.maxDuration,
@@ -91,15 +178,86 @@ func (r *responseStats) log() {
 		"count_per_status": r.statusCodes,
 		"response_bodies":  r.bodies,
 		"errors":           r.errors,
-	}).Info("Summary of sent events")
+		"bytes_behind":     bytesBehind,
+	}
+	if !r.noSecondsBehind {
+		fields["seconds_behind"] = secondsBehind
+	}
+	// these are only there once something has been counted
+	if len(invalidBytes) > 0 {
+		fields["invalid_bytes"] = invalidBytes
+	}
+	if len(truncatedLines) > 0 {
+		fields["truncated_lines"] = truncatedLines
+	}
+	if len(droppedLines) > 0 {
+		fields["dropped_lines"] = droppedLines
+	}
+	if truncatedMessages := receiver.TruncatedMessages(); len(truncatedMessages) > 0 {
+		fields["truncated_messages"] = truncatedMessages
+	}
+	if len(r.unparsedLines) > 0 {
+		unparsedLines := make(map[string]int64, len(r.unparsedLines))
+		for parser, n := range r.unparsedLines {
+			unparsedLines[parser] = n
+		}
+		fields["unparsed_lines"] = unparsedLines
+	}
+	if len(r.fieldTypeErrors) > 0 {
+		fieldTypeErrors := make(map[string]int64, len(r.fieldTypeErrors))
+		for field, n := range r.fieldTypeErrors {
+			fieldTypeErrors[field] = n
+		}
+		fields["field_type_errors"] = fieldTypeErrors
+	}
+	if len(r.redactions) > 0 {
+		redactions := make(map[string]int64, len(r.redactions))
+		for name, n := range r.redactions {
+			redactions[name] = n
+		}
+		fields["redactions"] = redactions
+	}
+	logrus.WithFields(r.withPipeline(fields)).Info("Summary of sent events")
+	for file, bytes := range bytesBehind {
+		seconds, ok := secondsBehind[file]
+		if (r.lagWarningBytes > 0 && bytes > r.lagWarningBytes) ||
+			(r.lagWarningSeconds > 0 && ok && seconds > int64(r.lagWarningSeconds)) {
+			fields := logrus.Fields{
+				"file":         file,
+				"bytes_behind": bytes,
+			}
+			if ok {
+				fields["seconds_behind"] = seconds
+			}
+			logrus.WithFields(r.withPipeline(fields)).Warn("Tailing is falling behind the end of the file")
+		}
+	}
 	if r.event != nil {
 		fields := make(map[string]interface{})
 		fields["event"] = r.event.Data
 		fields["event_timestamp"] = r.event.Timestamp
-		logrus.WithFields(fields).Info("Last parsed event")
+		logrus.WithFields(r.withPipeline(fields)).Info("Last parsed event")
 	}
 }
 
+// reads is whether the pipeline reads file, either because it matches one of
+// its --file patterns or because it has sent events from it
+func (r *responseStats) reads(file string) bool {
+	for _, pattern := range r.files {
+		if pattern == file {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	if file == "-" {
+		file = ""
+	}
+	_, ok := r.newest[file]
+	return ok
+}
+
 // log the total count on its own
 func (r *responseStats) logFinal() {
 	r.lock.Lock()
@@ -108,10 +266,18 @@ func (r *responseStats) logFinal() {
 	for code, count := range r.statusCodes {
 		r.totalStatusCodes[code] += count
 	}
-	logrus.WithFields(logrus.Fields{
+	logrus.WithFields(r.withPipeline(logrus.Fields{
 		"total attempted sends":               r.totalCount,
 		"number sent by response status code": r.totalStatusCodes,
-	}).Info("Total number of events sent")
+	})).Info("Total number of events sent")
+}
+
+// withPipeline adds the name of the pipeline to fields, if it has one
+func (r *responseStats) withPipeline(fields logrus.Fields) logrus.Fields {
+	if r.pipeline != "" {
+		fields["pipeline"] = r.pipeline
+	}
+	return fields
 }
 
 // reset the counters to zero.
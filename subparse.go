@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// subparser parses the string in a field of each event with a line parser,
+// for --subparse
+type subparser struct {
+	field      string
+	parser     string
+	lineParser parsers.LineParser
+	// lineTimer finds the time of a parsed field with the parser's
+	// timefield and format options. nil if the parser has none.
+	lineTimer parsers.LineTimer
+	// prefix goes in front of the names of the fields found, to keep them
+	// from colliding with the event's own
+	prefix string
+}
+
+// newSubparsers makes the line parsers for --subparse, using the options of
+// their parsers
+func newSubparsers(options GlobalOptions) ([]subparser, error) {
+	var subparsers []subparser
+	for _, sp := range options.Subparse {
+		splitSP := strings.SplitN(sp, "=", 2)
+		if len(splitSP) != 2 || splitSP[0] == "" {
+			return nil, fmt.Errorf("unable to separate --subparse %s into a field=parser pair", sp)
+		}
+		parserName, prefix, _ := strings.Cut(splitSP[1], ":")
+		r := parsers.Lookup(parserName)
+		if r == nil {
+			return nil, fmt.Errorf("unknown parser %s in --subparse %s, use --list to show valid parsers", parserName, sp)
+		}
+		lineParser, lineTimer, err := r.NewLineParser(options.Parsers[r.Name], parsers.Settings{
+			NoTypeInference: options.NoTypeInference,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to use the %s parser for --subparse %s: %v", r.Name, sp, err)
+		}
+		if prefix != "" {
+			prefix += "_"
+		}
+		subparsers = append(subparsers, subparser{
+			field:      splitSP[0],
+			parser:     r.Name,
+			lineParser: lineParser,
+			lineTimer:  lineTimer,
+			prefix:     prefix,
+		})
+	}
+	return subparsers, nil
+}
+
+// subparse parses the field of ev, adding the fields found with the
+// subparser's prefix. With promoteTimestamp, a timestamp found in them becomes
+// the time of the event.
+func (sp subparser) subparse(ev *event.Event, promoteTimestamp bool) {
+	val, ok := ev.Data[sp.field].(string)
+	if !ok {
+		return
+	}
+	parsed, err := sp.lineParser.ParseLine(strings.TrimSpace(val))
+	if err != nil || len(parsed) == 0 {
+		logrus.WithFields(logrus.Fields{
+			"field":  sp.field,
+			"parser": sp.parser,
+			"error":  err,
+		}).Debug("Unable to parse field with --subparse")
+		return
+	}
+	if promoteTimestamp {
+		if sp.lineTimer != nil {
+			if ts, ok := sp.lineTimer(parsed); ok {
+				ev.Timestamp = ts
+			}
+		} else if httime.HasTimestamp(parsed) {
+			ev.Timestamp = httime.GetTimestamp(parsed, "", "")
+		}
+	}
+	for k, v := range parsed {
+		ev.Data[sp.prefix+k] = v
+	}
+}
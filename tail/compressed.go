@@ -0,0 +1,154 @@
+package tail
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionZstd
+	compressionBzip2
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	// the first block of a bzip2 stream starts with the digits of pi, an
+	// empty stream with the digits of sqrt(pi)
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EmptyMagic = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// getCompression works out how file is compressed, going by its magic bytes
+// or, failing that, its extension
+func getCompression(file string) compression {
+	fh, err := os.Open(file)
+	if err == nil {
+		defer fh.Close()
+		header := make([]byte, 10)
+		n, _ := io.ReadFull(fh, header)
+		header = header[:n]
+		switch {
+		case bytes.HasPrefix(header, gzipMagic):
+			return compressionGzip
+		case bytes.HasPrefix(header, zstdMagic):
+			return compressionZstd
+		case len(header) == 10 && bytes.HasPrefix(header, bzip2Magic) &&
+			header[3] >= '1' && header[3] <= '9' &&
+			(bytes.Equal(header[4:], bzip2BlockMagic) || bytes.Equal(header[4:], bzip2EmptyMagic)):
+			return compressionBzip2
+		}
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".gz":
+		return compressionGzip
+	case ".zst":
+		return compressionZstd
+	case ".bz2":
+		return compressionBzip2
+	}
+	return compressionNone
+}
+
+// IsCompressed returns true if file is compressed with gzip, zstd or bzip2
+func IsCompressed(file string) bool {
+	return getCompression(file) != compressionNone
+}
+
+// OpenCompressed opens a compressed file and returns a reader for its
+// decompressed contents. Files that aren't compressed are read as they are.
+func OpenCompressed(file string) (io.ReadCloser, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	d := &decompressedFile{fh: fh}
+	switch getCompression(file) {
+	case compressionGzip:
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(fh)
+		d.Reader, d.decompressor = gz, gz
+	case compressionZstd:
+		var dec *zstd.Decoder
+		if dec, err = zstd.NewReader(fh, zstd.WithDecoderConcurrency(1)); err == nil {
+			rc := dec.IOReadCloser()
+			d.Reader, d.decompressor = rc, rc
+		}
+	case compressionBzip2:
+		d.Reader = bzip2.NewReader(fh)
+	default:
+		d.Reader = fh
+	}
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// decompressedFile closes both the decompressor and the underlying file
+type decompressedFile struct {
+	io.Reader
+	decompressor io.Closer
+	fh           *os.File
+}
+
+func (d *decompressedFile) Close() error {
+	if d.decompressor != nil {
+		d.decompressor.Close()
+	}
+	return d.fh.Close()
+}
+
+// removeCompressedFiles goes through the list of files and removes any that
+// are compressed; those can only be read once with --tail.stop, not followed
+func removeCompressedFiles(files []string) []string {
+	newFiles := []string{}
+	for _, file := range files {
+		if IsCompressed(file) {
+			logrus.WithFields(logrus.Fields{
+				"file": file,
+			}).Debug("skipping tailing file because it is compressed and --tail.stop is not set")
+			continue
+		}
+		newFiles = append(newFiles, file)
+	}
+	return newFiles
+}
+
+// tailCompressedFile reads a compressed file from start to finish, sending
+// one line at a time down the returned channel. There is no statefile, as a
+// compressed file is always read in full, and line offsets are counted in the
+// decompressed contents.
+func tailCompressedFile(ctx context.Context, file string, maxBytes int) (chan event.Line, error) {
+	r, err := OpenCompressed(file)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(chan event.Line)
+	go func() {
+		defer close(lines)
+		defer r.Close()
+		if err := sendLines(ctx, r, file, 0, maxBytes, lines); err != nil {
+			logrus.WithError(err).WithField("file", file).
+				Error("unable to decompress file")
+		}
+	}()
+	return lines, nil
+}
@@ -0,0 +1,104 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bzip2 of "{\"bz\":1}\n{\"bz\":2}\n"; the standard library can't write bzip2
+const bzip2Lines = "QlpoOTFBWSZTWXhljlIAAAdZgAAQEAAwEBAAABogACEoCb1QgyYhOE40E8L8XckU4UJB4ZY5SA=="
+
+func (ts *testSetup) writeGzip(t *testing.T, path string, body string) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(body))
+	gz.Close()
+	ts.writeFile(t, path, buf.String())
+}
+
+func (ts *testSetup) writeZstd(t *testing.T, path string, body string) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, path, string(enc.EncodeAll([]byte(body), nil)))
+}
+
+func (ts *testSetup) writeBzip2(t *testing.T, path string) {
+	body, err := base64.StdEncoding.DecodeString(bzip2Lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, path, string(body))
+}
+
+func TestGetEntriesCompressed(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeFile(t, ts.tmpdir+"/access.log", "{\"plain\":1}\n{\"plain\":2}")
+	ts.writeGzip(t, ts.tmpdir+"/access.log.1.gz", "{\"gz\":1}\n{\"gz\":2}\n")
+	ts.writeZstd(t, ts.tmpdir+"/access.log.2.zst", "{\"zst\":1}\n{\"zst\":2}\n")
+	ts.writeBzip2(t, ts.tmpdir+"/access.log.3.bz2")
+	// compression is detected from the contents when the extension is missing
+	ts.writeGzip(t, ts.tmpdir+"/access.log.4", "{\"gz\":4}\n")
+
+	conf := Config{
+		Paths:   []string{ts.tmpdir + "/access.log*"},
+		Options: tailOpts,
+	}
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"{\"plain\":1}", "{\"plain\":2}"},
+		{"{\"gz\":1}", "{\"gz\":2}"},
+		{"{\"zst\":1}", "{\"zst\":2}"},
+		{"{\"bz\":1}", "{\"bz\":2}"},
+		{"{\"gz\":4}"},
+	}
+	if len(chanArr) != len(expected) {
+		t.Fatalf("expected %d channels, got %d", len(expected), len(chanArr))
+	}
+	for i, ch := range chanArr {
+		checkLinesChan(t, ch, expected[i])
+	}
+
+	// compressed files can't be followed, so they're skipped without --tail.stop
+	conf.Options.Stop = false
+	conf.Options.StateFile = ts.tmpdir
+	chanArr, err = GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chanArr) != 1 {
+		t.Errorf("expected only the plain file to be tailed, got %d channels", len(chanArr))
+	}
+}
+
+func TestIsCompressed(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeFile(t, ts.tmpdir+"/plain.log", "BZh9 is not bzip2\n")
+	ts.writeFile(t, ts.tmpdir+"/empty.gz", "")
+	ts.writeBzip2(t, ts.tmpdir+"/bzip2.log")
+	tsts := map[string]bool{
+		"plain.log": false,
+		"empty.gz":  true,
+		"bzip2.log": true,
+		"missing":   false,
+	}
+	for file, expected := range tsts {
+		if actual := IsCompressed(ts.tmpdir + "/" + file); actual != expected {
+			t.Errorf("IsCompressed(%s) = %t, expected %t", file, actual, expected)
+		}
+	}
+}
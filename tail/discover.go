@@ -0,0 +1,414 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/tenebris-tech/tail"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// discoverPollInterval is how often the --file globs are checked for new
+// files when --tail.poll is set
+var discoverPollInterval = time.Second
+
+// discoverRescanInterval is how often the --file globs are checked when using
+// inotify, in case an event was missed or a new directory started matching
+var discoverRescanInterval = 10 * time.Second
+
+// copyTruncateWait is how long a new file that starts like a tailed file is
+// left for the tailed one to be truncated, before it's tailed as a file of
+// its own
+var copyTruncateWait = 5 * time.Second
+
+// WatchEntries is like GetEntries, but keeps watching for files that start
+// matching conf.Paths after startup. It returns a channel on which it sends
+// one lines channel per tailed file, starting with the files that exist now.
+// When a file is deleted its lines channel is closed once the file has been
+// read to the end. The returned channel is closed when ctx is cancelled.
+func WatchEntries(ctx context.Context, conf Config) (chan chan event.Line, error) {
+	return watchEntries(ctx, conf, func(lines chan event.Line) chan event.Line {
+		return lines
+	})
+}
+
+// WatchSampledEntries wraps WatchEntries and sends channels that provide
+// sampled entries. If rng is non-nil it will be used for sampling decisions;
+// otherwise the global math/rand source is used.
+func WatchSampledEntries(ctx context.Context, conf Config, sampleRate uint, rng *rand.Rand) (chan chan event.Line, error) {
+	return watchEntries(ctx, conf, func(lines chan event.Line) chan event.Line {
+		if sampleRate == 1 {
+			return lines
+		}
+		return SampleLines(lines, sampleRate, rng)
+	})
+}
+
+// fileWatcher keeps track of the files being tailed while watching for new
+// ones
+type fileWatcher struct {
+	conf Config
+	// seen has every file matching the globs, whether it's tailed or skipped
+	seen    map[string]bool
+	tailers map[string]*tail.Tail
+	// ids has what each tailed file looked like at the last check, to
+	// recognize it once it's rotated to another name that matches the globs
+	ids map[string]fileID
+	// undecided has when each new file that may be a copy of a tailed one
+	// was first found
+	undecided map[string]time.Time
+	// wrap is applied to each lines channel before it's handed out
+	wrap func(chan event.Line) chan event.Line
+	// notify is nil when polling
+	notify *fsnotify.Watcher
+}
+
+func watchEntries(ctx context.Context, conf Config, wrap func(chan event.Line) chan event.Line) (chan chan event.Line, error) {
+	if conf.Type != RotateStyleSyslog {
+		return nil, errors.New("Discovering new files is only supported with syslog style rotation")
+	}
+	reading, err := parseLineOptions(conf.Options)
+	if err != nil {
+		return nil, err
+	}
+	// a file that's deleted or replaced is left for the watcher to find again
+	conf.Options.DiscoverFiles = true
+	fw := &fileWatcher{
+		conf:      conf,
+		seen:      make(map[string]bool),
+		tailers:   make(map[string]*tail.Tail),
+		ids:       make(map[string]fileID),
+		undecided: make(map[string]time.Time),
+		wrap: func(lines chan event.Line) chan event.Line {
+			return wrap(readLines(lines, reading))
+		},
+	}
+	if !conf.Options.Poll {
+		var err error
+		if fw.notify, err = fsnotify.NewWatcher(); err != nil {
+			return nil, err
+		}
+	}
+
+	// start with everything that matches right now
+	initial := make([]chan event.Line, 0, len(conf.Paths))
+	for _, pattern := range conf.Paths {
+		if pattern == "-" {
+			initial = append(initial, fw.wrap(tailStdIn(ctx, conf.Options.MaxLineBytes)))
+		}
+	}
+	files, _, err := fw.glob()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		lines, err := fw.tail(ctx, conf, file)
+		if err != nil {
+			return nil, err
+		}
+		initial = append(initial, lines)
+	}
+	fw.watchDirs()
+
+	linesChans := make(chan chan event.Line, len(initial))
+	for _, lines := range initial {
+		linesChans <- lines
+	}
+	go fw.run(ctx, linesChans)
+	return linesChans, nil
+}
+
+// tail starts tailing file and records its tailer
+func (fw *fileWatcher) tail(ctx context.Context, conf Config, file string) (chan event.Line, error) {
+	// files come and go, so they can't share a single --tail.statefile;
+	// statefiles are always derived from each file's name
+	stateFile := getStateFile(conf, file, 2)
+	tailer, err := getTailer(conf, file, stateFile)
+	if err != nil {
+		return nil, err
+	}
+	fw.tailers[file] = tailer
+	if id, ok := identify(file); ok {
+		fw.ids[file] = id
+	}
+	return fw.wrap(tailSingleFile(ctx, conf, tailer, file, stateFile)), nil
+}
+
+// run re-checks the globs whenever something is created or removed in a
+// watched directory, or on a timer, until ctx is cancelled
+func (fw *fileWatcher) run(ctx context.Context, linesChans chan chan event.Line) {
+	defer close(linesChans)
+	interval := discoverPollInterval
+	var events chan fsnotify.Event
+	var errs chan error
+	if fw.notify != nil {
+		defer fw.notify.Close()
+		interval = discoverRescanInterval
+		events = fw.notify.Events
+		errs = fw.notify.Errors
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// writes to files we're already tailing don't change the set
+			// of files
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Remove) && !ev.Has(fsnotify.Rename) {
+				continue
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			logrus.WithError(err).Warn("error watching directories for new files")
+			continue
+		}
+		if !fw.rescan(ctx, linesChans) {
+			return
+		}
+	}
+}
+
+// glob expands the globs and returns the files that haven't been seen
+// before and should be tailed, along with every file that currently matches
+func (fw *fileWatcher) glob() ([]string, map[string]bool, error) {
+	var fresh []string
+	present := make(map[string]bool)
+	for _, pattern := range fw.conf.Paths {
+		if pattern == "-" {
+			continue
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range files {
+			present[file] = true
+			if !fw.seen[file] {
+				fw.seen[file] = true
+				fresh = append(fresh, file)
+			}
+		}
+	}
+	return filterFiles(fresh, fw.conf), present, nil
+}
+
+// rescan starts tailing files that newly match the globs and stops tailing
+// files that no longer exist. It returns false if ctx was cancelled.
+func (fw *fileWatcher) rescan(ctx context.Context, linesChans chan chan event.Line) bool {
+	files, present, err := fw.glob()
+	if err != nil {
+		logrus.WithError(err).Warn("unable to check for new files to tail")
+		return true
+	}
+	for _, file := range files {
+		rotated, undecided := fw.tailedAs(file)
+		if rotated != "" {
+			// eg. access.log.1 matching access.log*, which was read as
+			// access.log before it was rotated
+			logrus.WithFields(logrus.Fields{
+				"file":         file,
+				"rotated_from": rotated,
+			}).Info("newly found file is a rotated file that's already been tailed, not tailing it again")
+			delete(fw.undecided, file)
+			continue
+		}
+		if undecided {
+			// check it again next time, in case it's a copy and the file
+			// it was copied from is about to be truncated
+			first, ok := fw.undecided[file]
+			if !ok {
+				first = time.Now()
+				fw.undecided[file] = first
+			}
+			if time.Since(first) < copyTruncateWait {
+				delete(fw.seen, file)
+				continue
+			}
+		}
+		delete(fw.undecided, file)
+		conf := fw.conf
+		if _, ok := readStateFile(getStateFile(conf, file, 2)); ok {
+			// it's been tailed before, so carry on from its statefile
+			conf.Options.ReadFrom = "last"
+		} else {
+			// anything else that shows up after startup is new, so read
+			// all of it
+			conf.Options.ReadFrom = "beginning"
+		}
+		lines, err := fw.tail(ctx, conf, file)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).
+				Warn("unable to tail newly found file")
+			continue
+		}
+		logrus.WithField("file", file).Info("found new file to tail")
+		select {
+		case linesChans <- lines:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for file := range fw.undecided {
+		if !present[file] {
+			delete(fw.undecided, file)
+		}
+	}
+	for file := range fw.seen {
+		if present[file] {
+			continue
+		}
+		delete(fw.seen, file)
+		delete(fw.ids, file)
+		if tailer, ok := fw.tailers[file]; ok {
+			logrus.WithField("file", file).Info("file is gone, stopping tailing it")
+			delete(fw.tailers, file)
+			// StopAtEOF waits for the rest of the file to be read, so don't
+			// block here
+			go tailer.StopAtEOF()
+		}
+	}
+	for file, id := range fw.ids {
+		info, err := os.Stat(file)
+		if err != nil || os.SameFile(info, id.info) {
+			continue
+		}
+		// the file was replaced by a new one, eg. by rotation, and its
+		// tailer stops at the end of the old one, so read all of the new one
+		conf := fw.conf
+		conf.Options.ReadFrom = "beginning"
+		lines, err := fw.tail(ctx, conf, file)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).
+				Warn("unable to tail replaced file")
+			continue
+		}
+		logrus.WithField("file", file).Info("file was replaced, tailing the new one")
+		select {
+		case linesChans <- lines:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for file := range fw.tailers {
+		if id, ok := identify(file); ok {
+			fw.ids[file] = id
+		}
+	}
+	fw.watchDirs()
+	return true
+}
+
+// fileID is what a file looked like when it was checked
+type fileID struct {
+	info os.FileInfo
+	// checksum is the fingerprint of the first checksumBytes of the file
+	checksum      string
+	checksumBytes int64
+}
+
+// identify returns what file looks like now
+func identify(file string) (fileID, bool) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileID{}, false
+	}
+	checksum, checksumBytes, err := getFingerprint(file, fingerprintBytes)
+	if err != nil {
+		return fileID{}, false
+	}
+	return fileID{info: info, checksum: checksum, checksumBytes: checksumBytes}, true
+}
+
+// tailedAs returns the name of the tailed file that file was when last
+// checked, or "" if it's none of them. That's going by its inode, or by its
+// fingerprint if the tailed file was copied away, as files with the same
+// header are otherwise told apart by their inodes. undecided is set when file
+// starts like a tailed file that's still as it was, as copytruncate copies a
+// file before truncating it.
+func (fw *fileWatcher) tailedAs(file string) (tailed string, undecided bool) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", false
+	}
+	for tailed, id := range fw.ids {
+		if tailed == file {
+			continue
+		}
+		if os.SameFile(info, id.info) {
+			return tailed, false
+		}
+		// empty files all look alike
+		if id.checksumBytes == 0 {
+			continue
+		}
+		checksum, checksumBytes, err := getFingerprint(file, id.checksumBytes)
+		if err != nil || checksumBytes != id.checksumBytes || checksum != id.checksum {
+			continue
+		}
+		if copiedAway(tailed, id) {
+			return tailed, false
+		}
+		undecided = true
+	}
+	return "", undecided
+}
+
+// copiedAway is whether the file tailed as file may have been copied
+// somewhere else since it was checked: it was truncated like copytruncate
+// does, or it isn't at its name any more
+func copiedAway(file string, id fileID) bool {
+	info, err := os.Stat(file)
+	if err != nil || !os.SameFile(info, id.info) {
+		return true
+	}
+	return info.Size() < id.info.Size()
+}
+
+// watchDirs adds an inotify watch for every directory that might hold files
+// matching the globs
+func (fw *fileWatcher) watchDirs() {
+	if fw.notify == nil {
+		return
+	}
+	watched := make(map[string]bool)
+	for _, dir := range fw.notify.WatchList() {
+		watched[dir] = true
+	}
+	for _, pattern := range fw.conf.Paths {
+		if pattern == "-" {
+			continue
+		}
+		dirs, err := filepath.Glob(filepath.Dir(pattern))
+		if err != nil {
+			continue
+		}
+		for _, dir := range dirs {
+			if watched[dir] {
+				continue
+			}
+			if err := fw.notify.Add(dir); err != nil {
+				logrus.WithError(err).WithField("dir", dir).
+					Debug("unable to watch directory for new files")
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package tail
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestWatchEntries(t *testing.T) {
+	for _, poll := range []bool{true, false} {
+		ts := &testSetup{}
+		ts.start(t)
+		defer ts.stop()
+		defer func(interval time.Duration) { discoverPollInterval = interval }(discoverPollInterval)
+		discoverPollInterval = 10 * time.Millisecond
+
+		conf := Config{
+			Paths:       []string{ts.tmpdir + "/*.log"},
+			FilterPaths: []string{ts.tmpdir + "/skip*"},
+			Options: TailOptions{
+				ReadFrom:  "end",
+				Poll:      poll,
+				StateFile: ts.tmpdir,
+			},
+		}
+		ts.writeFile(t, ts.tmpdir+"/first.log", "{\"a\":1}\n")
+
+		linesChans, err := WatchEntries(ts.ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := expectLinesChan(t, linesChans)
+
+		// filtered files are never picked up, new matching files are read
+		// from the beginning regardless of --tail.read_from
+		ts.writeFile(t, ts.tmpdir+"/skip.log", "{\"skip\":1}\n")
+		ts.writeFile(t, ts.tmpdir+"/second.log", "{\"b\":1}\n")
+		second := expectLinesChan(t, linesChans)
+		expectLine(t, second, "{\"b\":1}")
+
+		// deleting a file stops tailing it
+		if err := os.Remove(ts.tmpdir + "/first.log"); err != nil {
+			t.Fatal(err)
+		}
+		checkLinesChanClosed(t, first)
+
+		ts.cancel()
+		checkLinesChanClosed(t, second)
+		select {
+		case _, ok := <-linesChans:
+			if ok {
+				t.Error("expected no more lines channels after cancelling")
+			}
+		case <-time.After(time.Second):
+			t.Error("lines channels channel not closed after cancelling")
+		}
+	}
+}
+
+func TestWatchEntriesRotation(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { discoverPollInterval = interval }(discoverPollInterval)
+	discoverPollInterval = 10 * time.Millisecond
+
+	conf := Config{
+		Paths: []string{ts.tmpdir + "/access.log*"},
+		Options: TailOptions{
+			ReadFrom:  "beginning",
+			Poll:      true,
+			StateFile: ts.tmpdir,
+		},
+	}
+	ts.writeFile(t, ts.tmpdir+"/access.log", "{\"a\":1}\n")
+	linesChans, err := WatchEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := expectLinesChan(t, linesChans)
+	expectLine(t, lines, "{\"a\":1}")
+
+	// rotating by renaming, or by copying like copytruncate, gives a file
+	// that matches the glob but has already been read
+	if err := os.Rename(ts.tmpdir+"/access.log", ts.tmpdir+"/access.log.1"); err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, ts.tmpdir+"/access.log.2", "{\"a\":1}\n")
+	select {
+	case <-linesChans:
+		t.Error("expected rotated files not to be tailed again")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the new file rotation leaves under the old name is read from the start
+	ts.writeFile(t, ts.tmpdir+"/access.log", "{\"c\":1}\n")
+	expectLine(t, expectLinesChan(t, linesChans), "{\"c\":1}")
+
+	// and so is a file moved over it without it ever being missing
+	ts.writeFile(t, ts.tmpdir+"/next", "{\"d\":1}\n")
+	if err := os.Rename(ts.tmpdir+"/next", ts.tmpdir+"/access.log"); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, expectLinesChan(t, linesChans), "{\"d\":1}")
+
+	// a file that's really new still is
+	ts.writeFile(t, ts.tmpdir+"/access.log.new", "{\"b\":1}\n")
+	expectLine(t, expectLinesChan(t, linesChans), "{\"b\":1}")
+}
+
+func TestWatchEntriesSameHeader(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { discoverPollInterval = interval }(discoverPollInterval)
+	discoverPollInterval = 10 * time.Millisecond
+	defer func(wait time.Duration) { copyTruncateWait = wait }(copyTruncateWait)
+	copyTruncateWait = 200 * time.Millisecond
+
+	conf := Config{
+		Paths: []string{ts.tmpdir + "/*.csv"},
+		Options: TailOptions{
+			ReadFrom:  "beginning",
+			Poll:      true,
+			StateFile: ts.tmpdir,
+		},
+	}
+	ts.writeFile(t, ts.tmpdir+"/a.csv", "time,msg\n1,a\n")
+	linesChans, err := WatchEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := expectLinesChan(t, linesChans)
+	expectLine(t, lines, "time,msg")
+	expectLine(t, lines, "1,a")
+
+	// a new file that starts the same way isn't a copy of one being tailed
+	// if that one stays as it was
+	ts.writeFile(t, ts.tmpdir+"/b.csv", "time,msg\n1,a\n2,b\n")
+	lines = expectLinesChan(t, linesChans)
+	expectLine(t, lines, "time,msg")
+	expectLine(t, lines, "1,a")
+	expectLine(t, lines, "2,b")
+
+	// but if it's truncated after the copy is made, it is
+	ts.writeFile(t, ts.tmpdir+"/c.csv", "time,msg\n1,a\n2,b\n")
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Truncate(ts.tmpdir+"/b.csv", 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-linesChans:
+		t.Error("expected a copied file not to be tailed again")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func expectLinesChan(t *testing.T, linesChans chan chan event.Line) chan event.Line {
+	select {
+	case lines := <-linesChans:
+		return lines
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a new lines channel")
+	}
+	return nil
+}
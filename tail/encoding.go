@@ -0,0 +1,277 @@
+package tail
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// Encoding is the character encoding of the lines in a file
+type Encoding int
+
+const (
+	// lines are passed along as they are
+	EncodingNone Encoding = iota
+	EncodingUTF8
+	EncodingLatin1
+	EncodingWindows1252
+	EncodingUTF16LE
+	EncodingUTF16BE
+)
+
+// ParseEncoding converts the value of --tail.encoding to an Encoding. An empty
+// value means lines are passed along as they are.
+func ParseEncoding(encoding string) (Encoding, error) {
+	switch strings.ToLower(encoding) {
+	case "":
+		return EncodingNone, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, nil
+	case "latin1", "latin-1", "iso-8859-1":
+		return EncodingLatin1, nil
+	case "windows-1252", "cp1252":
+		return EncodingWindows1252, nil
+	case "utf-16le":
+		return EncodingUTF16LE, nil
+	case "utf-16be":
+		return EncodingUTF16BE, nil
+	}
+	return EncodingNone, fmt.Errorf("unknown option to --tail.encoding: %s", encoding)
+}
+
+// byteOrderMarks are the byte order marks recognized at the start of a file,
+// and the encodings they mean
+var byteOrderMarks = []struct {
+	bom      string
+	encoding Encoding
+}{
+	{"\xef\xbb\xbf", EncodingUTF8},
+	{"\xff\xfe", EncodingUTF16LE},
+	{"\xfe\xff", EncodingUTF16BE},
+}
+
+// windows1252 has the characters for bytes 0x80 to 0x9f, which is where
+// Windows-1252 differs from Latin-1. The bytes it leaves undefined are
+// utf8.RuneError.
+var windows1252 = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+// invalidBytes has how many bytes that weren't valid in their encoding have
+// been replaced in each file
+var invalidBytes = struct {
+	sync.Mutex
+	m map[string]int64
+}{m: make(map[string]int64)}
+
+// recordInvalidBytes adds n to the count of invalid bytes in file
+func recordInvalidBytes(file string, n int) {
+	if n == 0 {
+		return
+	}
+	invalidBytes.Lock()
+	defer invalidBytes.Unlock()
+	invalidBytes.m[file] += int64(n)
+}
+
+// InvalidBytes returns how many bytes that weren't valid in the encoding set
+// by --tail.encoding have been replaced in each file since honeytail started.
+// STDIN is "-".
+func InvalidBytes() map[string]int64 {
+	invalidBytes.Lock()
+	defer invalidBytes.Unlock()
+	invalid := make(map[string]int64, len(invalidBytes.m))
+	for file, n := range invalidBytes.m {
+		invalid[file] = n
+	}
+	return invalid
+}
+
+// lineDecoder converts the lines of one file to UTF-8. Lines are read
+// from files by splitting on the byte '\n', which only lines up with the end
+// of a line in UTF-16 some of the time, so the decoder keeps track of where it
+// is in the file to put the lines back together.
+type lineDecoder struct {
+	encoding Encoding
+	// pos is where in the file the next line starts
+	pos int64
+	// carry is the start of a UTF-16 line that was split on a '\n' byte
+	// that was part of another character
+	carry []byte
+	// invalid counts the bytes replaced in the line being decoded
+	invalid int
+}
+
+// decodeLines converts each line read from lines to UTF-8 from encoding, or
+// from the encoding given by a byte order mark at the start of a file, and
+// removes the byte order mark. Bytes that aren't valid are replaced with
+// U+FFFD and counted in InvalidBytes. It returns lines unchanged for
+// EncodingNone.
+//
+// UTF-16 lines are split from each other when a '\n' byte lines up with the
+// start of a character, which is taken to be U+000A. For UTF-16LE that's
+// decided before seeing the byte after it, so U+010A, U+020A and so on split
+// the line they're in and count as invalid. Empty UTF-16 lines are dropped.
+func decodeLines(lines chan event.Line, encoding Encoding) chan event.Line {
+	if encoding == EncodingNone {
+		return lines
+	}
+	decoded := make(chan event.Line)
+	go func() {
+		defer close(decoded)
+		var source string
+		var d *lineDecoder
+		for line := range lines {
+			start := line.Offset - int64(len(line.Text)) - 1
+			if d == nil || line.Source != source || (line.Offset > 0 && start <= 0) {
+				// a new file, or the file was replaced and is being read
+				// from the start again
+				source = line.Source
+				d = &lineDecoder{encoding: encoding}
+				if line.Offset > 0 && start > 0 {
+					d.pos = start
+				}
+			}
+			text, ok := d.decode(line.Text)
+			file := line.Source
+			if file == "" {
+				file = "-"
+			}
+			recordInvalidBytes(file, d.invalid)
+			if ok {
+				line.Text = text
+				decoded <- line
+			}
+		}
+	}()
+	return decoded
+}
+
+// decode converts a line read up to a '\n' byte, returning false if there's
+// no line to send yet
+func (d *lineDecoder) decode(raw string) (string, bool) {
+	start := d.pos
+	d.pos += int64(len(raw)) + 1
+	d.invalid = 0
+	if start == 0 {
+		for _, mark := range byteOrderMarks {
+			if strings.HasPrefix(raw, mark.bom) {
+				d.encoding = mark.encoding
+				raw = raw[len(mark.bom):]
+				start += int64(len(mark.bom))
+				break
+			}
+		}
+	}
+	switch d.encoding {
+	case EncodingLatin1:
+		return d.decodeSingleByte(raw, nil), true
+	case EncodingWindows1252:
+		return d.decodeSingleByte(raw, &windows1252), true
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return d.decodeUTF16(raw, start)
+	}
+	return d.decodeUTF8(raw), true
+}
+
+func (d *lineDecoder) decodeUTF8(raw string) string {
+	if utf8.ValidString(raw) {
+		return raw
+	}
+	var b strings.Builder
+	for len(raw) > 0 {
+		r, size := utf8.DecodeRuneInString(raw)
+		if r == utf8.RuneError && size == 1 {
+			d.invalid++
+		}
+		b.WriteRune(r)
+		raw = raw[size:]
+	}
+	return b.String()
+}
+
+// decodeSingleByte decodes Latin-1, which has the same numbers as Unicode, or
+// Windows-1252 when high is set
+func (d *lineDecoder) decodeSingleByte(raw string, high *[32]rune) string {
+	var b strings.Builder
+	b.Grow(len(raw))
+	for i := 0; i < len(raw); i++ {
+		r := rune(raw[i])
+		if high != nil && r >= 0x80 && r < 0xa0 {
+			r = high[r-0x80]
+			if r == utf8.RuneError {
+				d.invalid++
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// decodeUTF16 decodes raw, which starts at offset start in the file
+func (d *lineDecoder) decodeUTF16(raw string, start int64) (string, bool) {
+	data := []byte(raw)
+	if len(d.carry) == 0 && start%2 == 1 {
+		// the first byte is the second half of the '\n' that ended the
+		// last line, which should be zero for U+000A
+		if len(data) == 0 {
+			// it was another '\n' byte
+			d.invalid++
+			return "", false
+		}
+		if data[0] != 0 {
+			d.invalid++
+		}
+		data = data[1:]
+	}
+	data = append(d.carry, data...)
+	d.carry = nil
+	// the '\n' byte that ended this line is the first half of a character
+	// in UTF-16LE, or the second half in UTF-16BE, when it ends U+000A
+	end := len(data)
+	newline := end%2 == 0
+	if d.encoding == EncodingUTF16BE {
+		newline = end%2 == 1 && data[end-1] == 0
+		end--
+	}
+	if !newline {
+		d.carry = append(data, '\n')
+		return "", false
+	}
+	data = data[:end]
+	if len(data) == 0 {
+		return "", false
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if d.encoding == EncodingUTF16BE {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(units); i++ {
+		r := rune(units[i])
+		if utf16.IsSurrogate(r) {
+			r = utf8.RuneError
+			if i+1 < len(units) {
+				if pair := utf16.DecodeRune(rune(units[i]), rune(units[i+1])); pair != utf8.RuneError {
+					r = pair
+					i++
+				}
+			}
+			if r == utf8.RuneError {
+				// an unpaired surrogate
+				d.invalid += 2
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), true
+}
@@ -0,0 +1,101 @@
+package tail
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseEncoding(t *testing.T) {
+	for _, encoding := range []string{"", "utf-8", "UTF8", "latin1", "iso-8859-1", "windows-1252", "utf-16le", "UTF-16BE"} {
+		if _, err := ParseEncoding(encoding); err != nil {
+			t.Errorf("unexpected error parsing %q: %s", encoding, err)
+		}
+	}
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+}
+
+// splitLines splits body on '\n' bytes the way the tailer does
+func splitLines(source string, body string) []event.Line {
+	var lines []event.Line
+	var offset int64
+	for _, text := range strings.Split(body, "\n") {
+		offset += int64(len(text)) + 1
+		lines = append(lines, event.Line{Text: text, Source: source, Offset: offset})
+	}
+	if lines[len(lines)-1].Text == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func TestDecodeLines(t *testing.T) {
+	tsts := []struct {
+		name     string
+		encoding Encoding
+		body     string
+		expected []string
+		invalid  int64
+	}{
+		{
+			name:     "latin1",
+			encoding: EncodingLatin1,
+			body:     "caf\xe9\n\xbfqu\xe9?\n",
+			expected: []string{"café", "¿qué?"},
+		},
+		{
+			name:     "windows-1252",
+			encoding: EncodingWindows1252,
+			body:     "\x93quoted\x94 \x80\n\x81\n",
+			expected: []string{"“quoted” €", "�"},
+			invalid:  1,
+		},
+		{
+			name:     "utf-8",
+			encoding: EncodingUTF8,
+			body:     "\xef\xbb\xbfok\nbad \xff\xfe\n",
+			expected: []string{"ok", "bad ��"},
+			invalid:  2,
+		},
+		{
+			name:     "utf-16le byte order mark",
+			encoding: EncodingLatin1,
+			// "aੁb\n😀\n", where the second byte of U+0A41 is a '\n'
+			body:     "\xff\xfea\x00\x41\x0ab\x00\x0a\x00\x3d\xd8\x00\xde\x0a\x00",
+			expected: []string{"aੁb", "😀"},
+		},
+		{
+			name:     "utf-16be",
+			encoding: EncodingUTF16BE,
+			body:     "\x00h\x00i\x00\x0a\x0a\x41\x00\x0a\xd8\x3d\x00\x0a",
+			expected: []string{"hi", "ੁ", "�"},
+			invalid:  2,
+		},
+	}
+	for _, tt := range tsts {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "/var/log/" + tt.name + ".log"
+			lines := make(chan event.Line)
+			go func() {
+				for _, line := range splitLines(source, tt.body) {
+					lines <- line
+				}
+				close(lines)
+			}()
+			var actual []string
+			for line := range decodeLines(lines, tt.encoding) {
+				actual = append(actual, line.Text)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("got %q, expected %q", actual, tt.expected)
+			}
+			if invalid := InvalidBytes()[source]; invalid != tt.invalid {
+				t.Errorf("got %d invalid bytes, expected %d", invalid, tt.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// Format describes how each line in a file is wrapped before it gets to the
+// parser
+type Format int
+
+const (
+	// each line is a log line
+	FormatPlain Format = iota
+	// lines written by a CRI container runtime like containerd or CRI-O:
+	// "<time> <stream> <P|F> <log>", where P marks part of a longer line
+	FormatCRI
+	// lines written by Docker's json-file logging driver:
+	// {"log":"...\n","stream":"stdout","time":"..."}, where a log that doesn't
+	// end in a newline is part of a longer line
+	FormatDockerJSON
+)
+
+// ParseFormat converts the value of --tail.format to a Format. An empty value
+// means plain lines.
+func ParseFormat(format string) (Format, error) {
+	switch format {
+	case "", "plain":
+		return FormatPlain, nil
+	case "cri":
+		return FormatCRI, nil
+	case "docker-json":
+		return FormatDockerJSON, nil
+	}
+	return FormatPlain, fmt.Errorf("unknown option to --tail.format: %s", format)
+}
+
+// containerLogName matches the names Kubernetes gives container logs in
+// /var/log/containers: <pod>_<namespace>_<container>-<container id>.log
+var containerLogName = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-[^-_]+\.log$`)
+
+// containerFields returns the Kubernetes pod, namespace and container named by
+// a container log's filename, or nil if it isn't named like one
+func containerFields(file string) map[string]interface{} {
+	match := containerLogName.FindStringSubmatch(filepath.Base(file))
+	if match == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"k8s.pod.name":       match[1],
+		"k8s.namespace.name": match[2],
+		"k8s.container.name": match[3],
+	}
+}
+
+// parseCRI splits a CRI log line into the stream it was written to and the
+// log, and says whether the log is complete or continues on the next line
+// from the same stream
+func parseCRI(text string) (stream string, log string, complete bool, ok bool) {
+	parts := strings.SplitN(text, " ", 4)
+	if len(parts) < 3 {
+		return "", "", false, false
+	}
+	if len(parts) == 4 {
+		log = parts[3]
+	}
+	// the tag may grow more flags after a colon
+	switch strings.SplitN(parts[2], ":", 2)[0] {
+	case "F":
+		return parts[1], log, true, true
+	case "P":
+		return parts[1], log, false, true
+	}
+	return "", "", false, false
+}
+
+// parseDockerJSON is parseCRI for Docker's json-file format
+func parseDockerJSON(text string) (stream string, log string, complete bool, ok bool) {
+	var entry struct {
+		Log    string `json:"log"`
+		Stream string `json:"stream"`
+	}
+	if err := json.Unmarshal([]byte(text), &entry); err != nil {
+		return "", "", false, false
+	}
+	log = strings.TrimSuffix(entry.Log, "\n")
+	return entry.Stream, log, log != entry.Log, true
+}
+
+// lineOptions are the TailOptions for getting lines ready for the parser
+type lineOptions struct {
+	format    Format
+	encoding  Encoding
+	maxBytes  int
+	longLines LongLineAction
+}
+
+// parseLineOptions checks the TailOptions used by readLines
+func parseLineOptions(options TailOptions) (lineOptions, error) {
+	var reading lineOptions
+	var err error
+	if reading.format, err = ParseFormat(options.Format); err != nil {
+		return reading, err
+	}
+	if reading.encoding, err = ParseEncoding(options.Encoding); err != nil {
+		return reading, err
+	}
+	if reading.longLines, err = ParseLongLineAction(options.LongLines); err != nil {
+		return reading, err
+	}
+	if options.MaxLineBytes < 0 {
+		return reading, fmt.Errorf("--tail.max_line_bytes must not be negative")
+	}
+	reading.maxBytes = options.MaxLineBytes
+	return reading, nil
+}
+
+// readLines gets lines read from a file ready for the parser, converting them
+// to UTF-8, unwrapping them and then cutting them down to size
+func readLines(lines chan event.Line, reading lineOptions) chan event.Line {
+	lines = unwrapLines(decodeLines(lines, reading.encoding), reading.format)
+	return limitLines(lines, reading.maxBytes, reading.longLines)
+}
+
+// unwrapLines strips the container runtime's envelope from each line read
+// from lines, joining lines that were split into parts, and adds Kubernetes
+// metadata from the file's name to Fields. Joined lines get the Offset of
+// their last part. It returns lines unchanged for FormatPlain.
+func unwrapLines(lines chan event.Line, format Format) chan event.Line {
+	if format == FormatPlain {
+		return lines
+	}
+	parse := parseCRI
+	if format == FormatDockerJSON {
+		parse = parseDockerJSON
+	}
+	unwrapped := make(chan event.Line)
+	go func() {
+		defer close(unwrapped)
+		// parts of lines that aren't complete yet, by stream
+		partial := make(map[string][]string)
+		var last event.Line
+		var fieldsSource string
+		var fields map[string]interface{}
+		send := func(line event.Line, text string) {
+			if line.Source != fieldsSource {
+				fieldsSource = line.Source
+				fields = containerFields(line.Source)
+			}
+			line.Text = text
+			line.Fields = fields
+			unwrapped <- line
+		}
+		for line := range lines {
+			last = line
+			stream, log, complete, ok := parse(line.Text)
+			if !ok {
+				logrus.WithFields(logrus.Fields{
+					"line": line.Text,
+					"file": line.Source,
+				}).Debug("line doesn't match --tail.format, passing it along as it is")
+				send(line, line.Text)
+				continue
+			}
+			if !complete {
+				partial[stream] = append(partial[stream], log)
+				continue
+			}
+			if parts, ok := partial[stream]; ok {
+				log = strings.Join(append(parts, log), "")
+				delete(partial, stream)
+			}
+			send(line, log)
+		}
+		// the file ended partway through a line, so send what there is of it
+		for _, parts := range partial {
+			send(last, strings.Join(parts, ""))
+		}
+	}()
+	return unwrapped
+}
@@ -0,0 +1,103 @@
+package tail
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range []string{"", "plain", "cri", "docker-json"} {
+		if _, err := ParseFormat(format); err != nil {
+			t.Errorf("unexpected error parsing %q: %s", format, err)
+		}
+	}
+	if _, err := ParseFormat("journald"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestContainerFields(t *testing.T) {
+	fields := containerFields("/var/log/containers/api-7d9f8b6c5-x2x4z_prod_api-server-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.log")
+	expected := map[string]interface{}{
+		"k8s.pod.name":       "api-7d9f8b6c5-x2x4z",
+		"k8s.namespace.name": "prod",
+		"k8s.container.name": "api-server",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("got %v, expected %v", fields, expected)
+	}
+	if fields := containerFields("/var/log/app.log"); fields != nil {
+		t.Errorf("expected no fields for a plain log, got %v", fields)
+	}
+}
+
+func TestUnwrapLines(t *testing.T) {
+	const source = "/var/log/containers/web_default_nginx-abc123.log"
+	k8s := map[string]interface{}{
+		"k8s.pod.name":       "web",
+		"k8s.namespace.name": "default",
+		"k8s.container.name": "nginx",
+	}
+	tsts := []struct {
+		name     string
+		format   Format
+		input    []string
+		expected []event.Line
+	}{
+		{
+			name:   "cri",
+			format: FormatCRI,
+			input: []string{
+				`2024-01-02T03:04:05.000000001Z stdout F {"a":1}`,
+				`2024-01-02T03:04:05.000000002Z stdout P {"b":`,
+				`2024-01-02T03:04:05.000000003Z stderr F oops`,
+				`2024-01-02T03:04:05.000000004Z stdout P 2,`,
+				`2024-01-02T03:04:05.000000005Z stdout F "c":3}`,
+				`not cri`,
+				`2024-01-02T03:04:05.000000006Z stdout F`,
+				`2024-01-02T03:04:05.000000007Z stdout P cut`,
+			},
+			expected: []event.Line{
+				{Text: `{"a":1}`, Source: source, Offset: 1, Fields: k8s},
+				{Text: `oops`, Source: source, Offset: 3, Fields: k8s},
+				{Text: `{"b":2,"c":3}`, Source: source, Offset: 5, Fields: k8s},
+				{Text: `not cri`, Source: source, Offset: 6, Fields: k8s},
+				{Text: ``, Source: source, Offset: 7, Fields: k8s},
+				{Text: `cut`, Source: source, Offset: 8, Fields: k8s},
+			},
+		},
+		{
+			name:   "docker-json",
+			format: FormatDockerJSON,
+			input: []string{
+				`{"log":"{\"a\":1}\n","stream":"stdout","time":"2024-01-02T03:04:05.000000001Z"}`,
+				`{"log":"{\"b\":","stream":"stdout","time":"2024-01-02T03:04:05.000000002Z"}`,
+				`{"log":"2}\n","stream":"stdout","time":"2024-01-02T03:04:05.000000003Z"}`,
+			},
+			expected: []event.Line{
+				{Text: `{"a":1}`, Source: source, Offset: 1, Fields: k8s},
+				{Text: `{"b":2}`, Source: source, Offset: 3, Fields: k8s},
+			},
+		},
+	}
+	for _, tt := range tsts {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make(chan event.Line)
+			go func() {
+				for i, text := range tt.input {
+					lines <- event.Line{Text: text, Source: source, Offset: int64(i + 1)}
+				}
+				close(lines)
+			}()
+			var actual []event.Line
+			for line := range unwrapLines(lines, tt.format) {
+				actual = append(actual, line)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("got %+v, expected %+v", actual, tt.expected)
+			}
+		})
+	}
+}
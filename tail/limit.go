@@ -0,0 +1,144 @@
+package tail
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// TruncatedField is added to events from lines that were cut short by
+// --tail.max_line_bytes
+const TruncatedField = "honeytail.truncated"
+
+// LongLineAction is what happens to lines longer than --tail.max_line_bytes
+type LongLineAction int
+
+const (
+	// keep the start of the line
+	LongLinesTruncate LongLineAction = iota
+	// skip the line
+	LongLinesDrop
+)
+
+// ParseLongLineAction converts the value of --tail.long_lines to a
+// LongLineAction. An empty value means truncate.
+func ParseLongLineAction(action string) (LongLineAction, error) {
+	switch action {
+	case "", "truncate":
+		return LongLinesTruncate, nil
+	case "drop":
+		return LongLinesDrop, nil
+	}
+	return LongLinesTruncate, fmt.Errorf("unknown option to --tail.long_lines: %s", action)
+}
+
+// longLines has how many lines of each file have been truncated or dropped
+// for being longer than --tail.max_line_bytes
+var longLines = struct {
+	sync.Mutex
+	truncated map[string]int64
+	dropped   map[string]int64
+}{truncated: make(map[string]int64), dropped: make(map[string]int64)}
+
+// recordLongLine counts a line from file that was truncated or dropped
+func recordLongLine(file string, action LongLineAction) {
+	if file == "" {
+		file = "-"
+	}
+	longLines.Lock()
+	defer longLines.Unlock()
+	if action == LongLinesDrop {
+		longLines.dropped[file]++
+	} else {
+		longLines.truncated[file]++
+	}
+}
+
+// LongLines returns how many lines of each file have been truncated and how
+// many have been dropped for being longer than --tail.max_line_bytes since
+// honeytail started. STDIN is "-".
+func LongLines() (map[string]int64, map[string]int64) {
+	longLines.Lock()
+	defer longLines.Unlock()
+	truncated := make(map[string]int64, len(longLines.truncated))
+	for file, n := range longLines.truncated {
+		truncated[file] = n
+	}
+	dropped := make(map[string]int64, len(longLines.dropped))
+	for file, n := range longLines.dropped {
+		dropped[file] = n
+	}
+	return truncated, dropped
+}
+
+// readLimitedLine reads up to the next '\n', keeping no more than limit+1
+// bytes of the line so that a runaway line doesn't have to fit in memory. A
+// limit of 0 keeps the whole line. It returns the line without its '\n', and
+// how many bytes were read including the '\n'. Like bufio.Reader.ReadString,
+// it returns what was read along with any error.
+func readLimitedLine(reader *bufio.Reader, limit int) (string, int64, error) {
+	var line []byte
+	var read int64
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		read += int64(len(chunk))
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if limit > 0 && len(line)+len(chunk) > limit+1 {
+			chunk = chunk[:limit+1-len(line)]
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), read, err
+		}
+	}
+}
+
+// limitLines truncates or drops lines read from lines that are longer than
+// maxBytes, counting them in LongLines. Truncated lines get TruncatedField
+// added to their Fields. It returns lines unchanged when maxBytes is 0.
+func limitLines(lines chan event.Line, maxBytes int, action LongLineAction) chan event.Line {
+	if maxBytes == 0 {
+		return lines
+	}
+	limited := make(chan event.Line)
+	go func() {
+		defer close(limited)
+		for line := range lines {
+			if len(line.Text) <= maxBytes {
+				limited <- line
+				continue
+			}
+			recordLongLine(line.Source, action)
+			logrus.WithFields(logrus.Fields{
+				"file":   line.Source,
+				"offset": line.Offset,
+				"bytes":  len(line.Text),
+			}).Debug("line is longer than --tail.max_line_bytes")
+			if action == LongLinesDrop {
+				continue
+			}
+			// cut at the start of a character so the line stays valid UTF-8
+			end := maxBytes
+			for end > 0 && !utf8.RuneStart(line.Text[end]) {
+				end--
+			}
+			line.Text = line.Text[:end]
+			// Fields can be shared between lines, so copy it
+			fields := make(map[string]interface{}, len(line.Fields)+1)
+			for k, v := range line.Fields {
+				fields[k] = v
+			}
+			fields[TruncatedField] = true
+			line.Fields = fields
+			limited <- line
+		}
+	}()
+	return limited
+}
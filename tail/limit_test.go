@@ -0,0 +1,110 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseLongLineAction(t *testing.T) {
+	for _, action := range []string{"", "truncate", "drop"} {
+		if _, err := ParseLongLineAction(action); err != nil {
+			t.Errorf("unexpected error parsing %q: %s", action, err)
+		}
+	}
+	if _, err := ParseLongLineAction("split"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
+
+func TestReadLimitedLine(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	// a small buffer so long lines take several reads
+	reader := bufio.NewReaderSize(strings.NewReader("short\n"+long+"\n"+long), 16)
+	expected := []struct {
+		text string
+		read int64
+		err  error
+	}{
+		{"short", 6, nil},
+		{long[:11], 101, nil},
+		{long[:11], 100, io.EOF},
+		{"", 0, io.EOF},
+	}
+	for _, e := range expected {
+		text, read, err := readLimitedLine(reader, 10)
+		if text != e.text || read != e.read || err != e.err {
+			t.Errorf("got %q, %d, %v, expected %q, %d, %v", text, read, err, e.text, e.read, e.err)
+		}
+	}
+}
+
+func TestLimitLines(t *testing.T) {
+	shared := map[string]interface{}{"k8s.pod.name": "web"}
+	input := []event.Line{
+		{Text: "short", Fields: shared},
+		{Text: "too long", Fields: shared},
+		{Text: "caffè!"},
+	}
+	tsts := []struct {
+		name     string
+		action   LongLineAction
+		expected []event.Line
+	}{
+		{
+			name:   "truncate",
+			action: LongLinesTruncate,
+			expected: []event.Line{
+				{Text: "short", Fields: shared},
+				{Text: "too l", Fields: map[string]interface{}{
+					"k8s.pod.name": "web",
+					TruncatedField: true,
+				}},
+				// a 'è' would be cut in half
+				{Text: "caff", Fields: map[string]interface{}{
+					TruncatedField: true,
+				}},
+			},
+		},
+		{
+			name:   "drop",
+			action: LongLinesDrop,
+			expected: []event.Line{
+				{Text: "short", Fields: shared},
+			},
+		},
+	}
+	for _, tt := range tsts {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make(chan event.Line)
+			go func() {
+				for _, line := range input {
+					line.Source = "/var/log/" + tt.name + ".log"
+					lines <- line
+				}
+				close(lines)
+			}()
+			var actual []event.Line
+			for line := range limitLines(lines, 5, tt.action) {
+				actual = append(actual, line)
+			}
+			for i := range tt.expected {
+				tt.expected[i].Source = "/var/log/" + tt.name + ".log"
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("got %v, expected %v", actual, tt.expected)
+			}
+			if len(shared) != 1 {
+				t.Errorf("Fields shared between lines were changed: %v", shared)
+			}
+		})
+	}
+	truncated, dropped := LongLines()
+	if truncated["/var/log/truncate.log"] != 2 || dropped["/var/log/drop.log"] != 2 {
+		t.Errorf("got %v truncated and %v dropped", truncated, dropped)
+	}
+}
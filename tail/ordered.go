@@ -0,0 +1,349 @@
+package tail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// rotatedNumber matches the number logrotate adds to the end of rotated
+// files, like access.log.3
+var rotatedNumber = regexp.MustCompile(`^(.*)\.(\d{1,5})$`)
+
+// rotatedDate matches a date, and optionally a time, in the name of a rotated
+// file, like access.log-20240102 or app-2024-01-02T15.log, along with the
+// separator before it
+var rotatedDate = regexp.MustCompile(`[-_.]?(\d{4})-?(\d{2})-?(\d{2})(?:[-_T]?(\d{2})(\d{2})?(\d{2})?)?`)
+
+// seriesFile is a file in a rotation series along with where it sorts
+type seriesFile struct {
+	name string
+	// series is the name with the rotation suffix and compression extension
+	// removed, which is the same for every file in a series
+	series string
+	// number is the logrotate number; higher numbers are older
+	number int
+	// date is the digits of the date in the name, which sort oldest first
+	date string
+}
+
+func newSeriesFile(file string) seriesFile {
+	f := seriesFile{name: file}
+	dir, base := filepath.Split(file)
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".gz", ".zst", ".bz2":
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if match := rotatedNumber.FindStringSubmatch(base); match != nil {
+		f.number, _ = strconv.Atoi(match[2])
+		base = match[1]
+	} else if loc := rotatedDate.FindStringSubmatchIndex(base); loc != nil {
+		match := rotatedDate.FindStringSubmatch(base)
+		f.date = strings.Join(match[1:], "")
+		base = base[:loc[0]] + base[loc[1]:]
+	}
+	f.series = dir + base
+	return f
+}
+
+// older returns true if f was rotated before g
+func (f seriesFile) older(g seriesFile) bool {
+	switch {
+	case f.number != g.number:
+		return f.number > g.number
+	case f.date != g.date:
+		// the live file has no date and comes after the dated ones
+		return g.date == "" || (f.date != "" && f.date < g.date)
+	}
+	return f.name < g.name
+}
+
+// SortSeries groups files into rotation series, like access.log.2.gz,
+// access.log.1 and access.log, or app.log-20240101 and app.log-20240102, and
+// sorts each series from oldest to newest. Files are ordered by the number
+// logrotate added to their name, then by the date in their name, with the
+// file that has neither last. The series are returned in order of the first
+// file in each.
+func SortSeries(files []string) [][]string {
+	var order []string
+	bySeries := make(map[string][]seriesFile)
+	for _, file := range files {
+		f := newSeriesFile(file)
+		if _, ok := bySeries[f.series]; !ok {
+			order = append(order, f.series)
+		}
+		bySeries[f.series] = append(bySeries[f.series], f)
+	}
+	sorted := make([][]string, 0, len(order))
+	for _, series := range order {
+		seriesFiles := bySeries[series]
+		sort.Slice(seriesFiles, func(i, j int) bool {
+			return seriesFiles[i].older(seriesFiles[j])
+		})
+		names := make([]string, len(seriesFiles))
+		for i, f := range seriesFiles {
+			names[i] = f.name
+		}
+		sorted = append(sorted, names)
+	}
+	return sorted
+}
+
+// OrderedPaths expands the globs in conf.Paths and sorts the files into
+// rotation series, leaving out statefiles and filtered paths
+func OrderedPaths(conf Config) ([][]string, error) {
+	var series [][]string
+	for _, pattern := range conf.Paths {
+		if pattern == "-" {
+			continue
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		// compressed files are read even when following, since they're
+		// finished with before the live file is reached
+		files = removeStateFiles(files, conf)
+		files = removeFilteredPaths(files, conf.FilterPaths)
+		series = append(series, SortSeries(files)...)
+	}
+	return series, nil
+}
+
+// getOrderedEntries sets up one channel for each rotation series matched by
+// conf.Paths. The older files in a series are read from start to finish in
+// order, leaving out those the series' statefile says have been read, then
+// the newest is tailed like any other file. Without a statefile, the newest
+// file is read from the beginning too.
+func getOrderedEntries(ctx context.Context, conf Config, reading lineOptions) ([]chan event.Line, error) {
+	allSeries, err := OrderedPaths(conf)
+	if err != nil {
+		return nil, err
+	}
+	var linesChans []chan event.Line
+	for _, pattern := range conf.Paths {
+		if pattern == "-" {
+			linesChans = append(linesChans, readLines(tailStdIn(ctx, conf.Options.MaxLineBytes), reading))
+		}
+	}
+	for _, files := range allSeries {
+		newest := files[len(files)-1]
+		if IsCompressed(newest) {
+			newestLines, err := tailCompressedFile(ctx, newest, conf.Options.MaxLineBytes)
+			if err != nil {
+				return nil, err
+			}
+			linesChans = append(linesChans, readLines(tailSeries(ctx, conf, files[:len(files)-1], "", func() chan event.Line {
+				return newestLines
+			}), reading))
+			continue
+		}
+		stateFile := getStateFile(conf, newest, len(allSeries))
+		newestConf := conf
+		if _, ok := readStateFile(stateFile); !ok && (conf.Options.ReadFrom == "" || conf.Options.ReadFrom == "last") {
+			// the older files are read, so don't skip what's in this one
+			newestConf.Options.ReadFrom = "beginning"
+		}
+		tailer, err := getTailer(newestConf, newest, stateFile)
+		if err != nil {
+			return nil, err
+		}
+		// the newest file is only followed once the older ones are read, so
+		// that what they've recorded in the statefile is kept
+		linesChans = append(linesChans, readLines(tailSeries(ctx, conf, files[:len(files)-1], stateFile, func() chan event.Line {
+			return tailSingleFile(ctx, newestConf, tailer, newest, stateFile)
+		}), reading))
+	}
+	if len(linesChans) == 0 {
+		return nil, errors.New("After removing missing files and state files from the list, there are no files left to tail")
+	}
+	return linesChans, nil
+}
+
+// tailSeries reads each of the older files in turn, then passes along the
+// lines of the newest file from tailNewest. A file starts from any of
+// conf.StartOffsets, or where the statefile left off if it was the newest
+// file when it was last saved. Files the statefile lists as read are skipped,
+// and each file is added to the list once it's been read.
+func tailSeries(ctx context.Context, conf Config, older []string, stateFile string, tailNewest func() chan event.Line) chan event.Line {
+	lines := make(chan event.Line)
+	go func() {
+		defer close(lines)
+		var state State
+		if stateFile != "" {
+			state, _ = readStateFile(stateFile)
+		}
+		// the file that was the newest last time
+		previous := RotatedFile{INode: state.INode, Checksum: state.Checksum, ChecksumBytes: state.ChecksumBytes}
+		// the files in the series that have been read, which leaves out any
+		// that are gone
+		var read []RotatedFile
+		for _, file := range older {
+			if i := indexRotated(state.Rotated, file); i >= 0 {
+				logrus.WithField("file", file).Debug("skipping rotated file that has already been read")
+				read = append(read, state.Rotated[i])
+				continue
+			}
+			logrus.WithField("file", file).Debug("reading rotated file")
+			if IsCompressed(file) {
+				fileLines, err := tailCompressedFile(ctx, file, conf.Options.MaxLineBytes)
+				if err != nil {
+					logrus.WithError(err).WithField("file", file).
+						Error("unable to read rotated file, skipping it")
+					continue
+				}
+				for line := range fileLines {
+					lines <- line
+				}
+			} else {
+				offset, ok := conf.StartOffsets[file]
+				if !ok && previous.Checksum != "" && previous.is(file) {
+					offset = state.Offset
+				}
+				readRemainingLines(ctx, file, offset, conf.Options.MaxLineBytes, lines)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if id, err := identifyRotated(file); err == nil && stateFile != "" {
+				read = append(read, id)
+				if err := recordRotated(stateFile, read); err != nil {
+					logrus.WithError(err).WithField("statefile", stateFile).
+						Warn("unable to record reading rotated file in the statefile")
+				}
+			}
+		}
+		for line := range tailNewest() {
+			lines <- line
+		}
+	}()
+	return lines
+}
+
+// RotatedFile identifies a file of a rotation series that has been read, in
+// the statefile of the series' newest file
+type RotatedFile struct {
+	// INode is the inode of the file. Compressing a file makes a new one,
+	// so compressed files are only recognized by their Checksum.
+	INode uint64 `json:",omitempty"`
+	// Checksum is the hex encoded sha256 of the first ChecksumBytes of the
+	// file, after decompressing it
+	Checksum      string
+	ChecksumBytes int64
+}
+
+// identifyRotated returns what identifies file once it's been read
+func identifyRotated(file string) (RotatedFile, error) {
+	var id RotatedFile
+	if !IsCompressed(file) {
+		logStat := unix.Stat_t{}
+		if err := unix.Stat(file, &logStat); err != nil {
+			return id, err
+		}
+		id.INode = uint64(logStat.Ino)
+	}
+	var err error
+	id.Checksum, id.ChecksumBytes, err = getContentFingerprint(file, fingerprintBytes)
+	return id, err
+}
+
+// is checks whether file is the file r identifies. An uncompressed file needs
+// the same inode as well as the same fingerprint, as a new file can start the
+// same way, eg. with a header.
+func (r RotatedFile) is(file string) bool {
+	if !IsCompressed(file) {
+		logStat := unix.Stat_t{}
+		if err := unix.Stat(file, &logStat); err != nil || uint64(logStat.Ino) != r.INode {
+			return false
+		}
+	}
+	checksum, checksumBytes, err := getContentFingerprint(file, r.ChecksumBytes)
+	return err == nil && checksum == r.Checksum && checksumBytes == r.ChecksumBytes
+}
+
+// indexRotated returns the index of file in rotated, or -1 if it isn't there
+func indexRotated(rotated []RotatedFile, file string) int {
+	for i, r := range rotated {
+		if r.is(file) {
+			return i
+		}
+	}
+	return -1
+}
+
+// getContentFingerprint is getFingerprint of what file decompresses to, so
+// that a file has the same fingerprint before and after it's compressed
+func getContentFingerprint(file string, n int64) (string, int64, error) {
+	if !IsCompressed(file) {
+		return getFingerprint(file, n)
+	}
+	r, err := OpenCompressed(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	read, err := io.Copy(h, io.LimitReader(r, n))
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), read, nil
+}
+
+// addRotated adds the file the state was saved for to the files of its
+// series that have been read, once it has been rotated
+func (state *State) addRotated() {
+	if state.Checksum == "" {
+		return
+	}
+	state.Rotated = append(state.Rotated, RotatedFile{
+		INode:         state.INode,
+		Checksum:      state.Checksum,
+		ChecksumBytes: state.ChecksumBytes,
+	})
+}
+
+// recordRotated saves the files of a series that have been read in its
+// statefile, keeping the rest of the state
+func recordRotated(stateFile string, rotated []RotatedFile) error {
+	stateFileWrites.Lock()
+	defer stateFileWrites.Unlock()
+	state, _ := readStateFile(stateFile)
+	state.Rotated = rotated
+	return saveState(stateFile, state)
+}
+
+// recordRotatedAway is addRotated for the state saved in stateFile
+func recordRotatedAway(stateFile string) error {
+	stateFileWrites.Lock()
+	defer stateFileWrites.Unlock()
+	state, ok := readStateFile(stateFile)
+	if !ok {
+		return nil
+	}
+	state.addRotated()
+	return saveState(stateFile, state)
+}
+
+// saveState writes state to stateFile
+func saveState(stateFile string, state State) error {
+	out, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(stateFile, append(out, '\n'), 0644)
+}
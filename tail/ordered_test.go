@@ -0,0 +1,209 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSortSeries(t *testing.T) {
+	sorted := SortSeries([]string{
+		"/var/log/nginx/access.log",
+		"/var/log/nginx/access.log.1",
+		"/var/log/nginx/access.log.10.gz",
+		"/var/log/nginx/access.log.2.gz",
+		"/var/log/nginx/error.log",
+		"/var/log/app/app.log-20240102",
+		"/var/log/app/app.log-20231231.bz2",
+		"/var/log/app/app.log",
+		"/var/log/app/app-2024-01-02T03.json",
+		"/var/log/app/app-2024-01-01T23.json",
+	})
+	expected := [][]string{
+		{
+			"/var/log/nginx/access.log.10.gz",
+			"/var/log/nginx/access.log.2.gz",
+			"/var/log/nginx/access.log.1",
+			"/var/log/nginx/access.log",
+		},
+		{"/var/log/nginx/error.log"},
+		{
+			"/var/log/app/app.log-20231231.bz2",
+			"/var/log/app/app.log-20240102",
+			"/var/log/app/app.log",
+		},
+		{
+			"/var/log/app/app-2024-01-01T23.json",
+			"/var/log/app/app-2024-01-02T03.json",
+		},
+	}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("got %v, expected %v", sorted, expected)
+	}
+}
+
+func TestGetOrderedEntries(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeGzip(t, ts.tmpdir+"/access.log.3.gz", "3a\n3b\n")
+	ts.writeZstd(t, ts.tmpdir+"/access.log.2.zst", "2a\n")
+	ts.writeFile(t, ts.tmpdir+"/access.log.1", "1a\n1b")
+	ts.writeFile(t, ts.tmpdir+"/access.log", "0a\n")
+	ts.writeFile(t, ts.tmpdir+"/error.log.1", "e1\n")
+	ts.writeFile(t, ts.tmpdir+"/error.log", "e0\n")
+
+	conf := Config{
+		Paths:   []string{ts.tmpdir + "/*.log*"},
+		Options: tailOpts,
+	}
+	conf.Options.Ordered = true
+	conf.Options.StateFile = ts.tmpdir
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chanArr) != 2 {
+		t.Fatalf("expected one channel per series, got %d", len(chanArr))
+	}
+	checkLinesChan(t, chanArr[0], []string{"3a", "3b", "2a", "1a", "1b", "0a"})
+	checkLinesChan(t, chanArr[1], []string{"e1", "e0"})
+
+	// without --tail.stop the newest file keeps getting followed
+	conf.Paths = []string{ts.tmpdir + "/access.log*"}
+	conf.Options.Stop = false
+	conf.Options.StateFile = ts.tmpdir + "/follow.leash.state"
+	chanArr, err = GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chanArr) != 1 {
+		t.Fatalf("expected one channel, got %d", len(chanArr))
+	}
+	for _, expected := range []string{"3a", "3b", "2a", "1a", "1b", "0a"} {
+		expectLine(t, chanArr[0], expected)
+	}
+	fh, err := os.OpenFile(ts.tmpdir+"/access.log", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.WriteString("0b\n")
+	fh.Close()
+	expectLine(t, chanArr[0], "0b")
+	ts.cancel()
+	checkLinesChanClosed(t, chanArr[0])
+
+	// timestamp style rotation has its own idea of order
+	conf.Type = RotateStyleTimestamp
+	if _, err := GetEntries(ts.ctx, conf); err == nil {
+		t.Error("expected an error reading files in order with timestamp style rotation")
+	}
+}
+
+func TestGetOrderedEntriesStateFile(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeGzip(t, ts.tmpdir+"/access.log.2.gz", "2a\n")
+	ts.writeFile(t, ts.tmpdir+"/access.log.1", "1a\n1b\n")
+	ts.writeFile(t, ts.tmpdir+"/access.log", "0a\n")
+
+	// the last run read the oldest file and part of access.log.1, back
+	// when it was the newest
+	stateFile := ts.tmpdir + "/access.leash.state"
+	read, err := identifyRotated(ts.tmpdir + "/access.log.2.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := identifyRotated(ts.tmpdir + "/access.log.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := json.Marshal(State{
+		INode:         previous.INode,
+		Offset:        3,
+		Size:          6,
+		Checksum:      previous.Checksum,
+		ChecksumBytes: previous.ChecksumBytes,
+		Rotated:       []RotatedFile{read},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, stateFile, string(state))
+
+	conf := Config{
+		Paths: []string{ts.tmpdir + "/access.log*"},
+		Options: TailOptions{
+			StateFile: stateFile,
+			Ordered:   true,
+			Stop:      true,
+		},
+	}
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chanArr) != 1 {
+		t.Fatalf("expected one channel, got %d", len(chanArr))
+	}
+	checkLinesChan(t, chanArr[0], []string{"1b", "0a"})
+}
+
+func TestGetOrderedEntriesRestart(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeGzip(t, ts.tmpdir+"/access.log.2.gz", "2a\n")
+	ts.writeFile(t, ts.tmpdir+"/access.log.1", "1a\n")
+	ts.writeFile(t, ts.tmpdir+"/access.log", "0a\n")
+
+	// with no statefile yet, the newest file is read from the beginning
+	// like the rest of the series
+	stateFile := ts.tmpdir + "/access.leash.state"
+	conf := Config{
+		Paths: []string{ts.tmpdir + "/access.log*"},
+		Options: TailOptions{
+			StateFile: stateFile,
+			Ordered:   true,
+		},
+	}
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"2a", "1a", "0a"} {
+		expectLine(t, chanArr[0], expected)
+	}
+	ts.cancel()
+	checkLinesChanClosed(t, chanArr[0])
+
+	saved, ok := readStateFile(stateFile)
+	if !ok {
+		t.Fatal("expected a statefile")
+	}
+	if len(saved.Rotated) != 2 {
+		t.Errorf("expected both rotated files in the statefile, got %v", saved.Rotated)
+	}
+
+	// starting again only sends what's new
+	ts.ctx, ts.cancel = context.WithCancel(context.Background())
+	chanArr, err = GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := os.OpenFile(ts.tmpdir+"/access.log", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.WriteString("0b\n")
+	fh.Close()
+	expectLine(t, chanArr[0], "0b")
+	ts.cancel()
+	checkLinesChanClosed(t, chanArr[0])
+}
@@ -1,25 +1,33 @@
 // Package tail implements tailing a log file.
 //
-// tail provides a channel on which log lines will be sent as string messages.
-// one line in the log file is one message on the channel
+// tail provides a channel on which log lines will be sent as event.Line
+// messages. one line in the log file is one message on the channel
 package tail
 
 import (
 	"bufio"
 	"context"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/tenebris-tech/tail"
 	"golang.org/x/sys/unix"
+
+	"github.com/honeycombio/honeytail/event"
 )
 
 type RotateStyle int
@@ -28,16 +36,55 @@ const (
 	// foo.log gets rotated to foo.log.1, new entries go to foo.log
 	RotateStyleSyslog RotateStyle = iota
 	// foo.log.OLDSTAMP gets closed, new entries go to foo.log.NEWSTAMP
-	// NOT YET IMPLEMENTED
 	RotateStyleTimestamp
 )
 
+// lagCheckInterval is how often each tailer checks how far behind the end of
+// its file it is
+var lagCheckInterval = time.Second
+
+// idleCheckInterval is how often each tailer checks whether its file has been
+// deleted or has gone quiet for --tail.idle_timeout, and how often a closed
+// file is checked for changes
+var idleCheckInterval = time.Second
+
+// replacedCheckInterval is how often the name of a file that was moved or
+// deleted is checked for the file that replaces it
+var replacedCheckInterval = 100 * time.Millisecond
+
+// rotateCheckInterval is how often a timestamp-rotated series is checked for
+// a newer file
+var rotateCheckInterval = time.Second
+
+// ParseRotateStyle converts the value of --tail.rotate_style to a RotateStyle.
+// An empty value means syslog style rotation.
+func ParseRotateStyle(style string) (RotateStyle, error) {
+	switch style {
+	case "", "syslog":
+		return RotateStyleSyslog, nil
+	case "timestamp":
+		return RotateStyleTimestamp, nil
+	}
+	return RotateStyleSyslog, fmt.Errorf("unknown option to --tail.rotate_style: %s", style)
+}
+
 type TailOptions struct {
 	ReadFrom              string `long:"read_from" description:"Location in the file from which to start reading. Values: beginning, end, last. Last picks up where it left off, if the file has not been rotated, otherwise beginning. When --backfill is set, it will override this option to beginning" yaml:"read_from,omitempty"`
 	Stop                  bool   `long:"stop" description:"Stop reading the file after reaching the end rather than continuing to tail. When --backfill is set, it will override this option=true" yaml:"stop,omitempty"`
 	Poll                  bool   `long:"poll" description:"use poll instead of inotify to tail files" yaml:"poll,omitempty"`
 	StateFile             string `long:"statefile" description:"File in which to store the last read position. Defaults to a file in /tmp named $logfile.leash.state. If tailing multiple files, default is forced." yaml:"statefile,omitempty"`
 	HashStateFileDirPaths bool   `long:"hash_statefile_paths" description:"Generates a hash of the directory path for each file that is used to uniquely identify each statefile. Prevents re-using the same statefile for tailed files that have the same name." yaml:"hash_statefile_paths,omitempty"`
+	DiscoverFiles         bool   `long:"discover_files" description:"Watch the directories of the --file globs and start tailing files that begin to match after startup. Files that are deleted stop being tailed. A file rotated to a name that matches, eg. access.log.1 for access.log*, is recognized by its inode and not read again, and so is a copy of one once the original is truncated, like copytruncate does. Has no effect with --tail.stop or timestamp style rotation." yaml:"discover_files,omitempty"`
+	RotateStyle           string `long:"rotate_style" description:"How the log files are rotated. Values: syslog, timestamp. Syslog means foo.log is renamed and a new foo.log is created. Timestamp means each --file glob matches a series of files like foo.log.2006-01-02 whose names sort in time order; honeytail follows the newest one and switches when a newer file appears. Defaults to syslog." yaml:"rotate_style,omitempty"`
+	CommitOnAck           bool   `long:"commit_on_ack" description:"Only advance the position saved in the statefile once Honeycomb has acknowledged the events from the lines before it, so nothing is lost if honeytail crashes or a batch fails. Lines may be sent again after a restart, and a statefile stops advancing at an event that failed to send until honeytail restarts. Each file is parsed by a single goroutine in this mode." yaml:"commit_on_ack,omitempty"`
+	LagWarningBytes       int64  `long:"lag_warning_bytes" description:"Log a warning with the periodic summary when a file has more than this many bytes left to read. 0 means never." yaml:"lag_warning_bytes,omitempty"`
+	LagWarningSeconds     uint   `long:"lag_warning_seconds" description:"Log a warning with the periodic summary when the newest event sent from a file is more than this many seconds old. Not used with --rebase_time or when backfilling. 0 means never." yaml:"lag_warning_seconds,omitempty"`
+	Ordered               bool   `long:"ordered" description:"Read each rotation series matched by a --file glob in order through a single parser, oldest first, like access.log.2.gz, access.log.1 and then access.log, or app.log-20240101 and then app.log-20240102. Rotated files are read from start to finish, then the newest file is tailed like any other unless --tail.stop is set, from the beginning if it has no statefile yet. The statefile remembers which rotated files have been read, so they aren't read again after a restart. Takes the place of --tail.discover_files, and only works with syslog style rotation." yaml:"ordered,omitempty"`
+	Format                string `long:"format" description:"How each line is wrapped. Values: plain, cri, docker-json. Cri and docker-json strip the envelope a container runtime puts around each line and join lines it split up, and add k8s.pod.name, k8s.namespace.name and k8s.container.name fields to events from files named like Kubernetes container logs (<pod>_<namespace>_<container>-<id>.log). Defaults to plain." yaml:"format,omitempty"`
+	Encoding              string `long:"encoding" description:"Character encoding of the files, to convert lines to UTF-8 before they're parsed. Values: utf-8, latin1, windows-1252, utf-16le, utf-16be. A byte order mark at the start of a file overrides this and is removed. Bytes that aren't valid in the encoding are replaced with U+FFFD and counted as invalid_bytes in the summary of sent events. Without this, lines are passed along as they are." yaml:"encoding,omitempty"`
+	MaxLineBytes          int    `long:"max_line_bytes" description:"Longest line to pass along, in bytes after any --tail.encoding and --tail.format. Longer lines are handled as set by --tail.long_lines and counted in the summary of sent events. STDIN and files read from start to finish only keep this much of a line in memory. Followed files are read a whole line at a time however long it is, and then cut down to this, so it doesn't limit their memory use. 0 means no limit." yaml:"max_line_bytes,omitempty"`
+	LongLines             string `long:"long_lines" description:"What to do with lines longer than --tail.max_line_bytes. Values: truncate, drop. Truncate keeps the start of the line and adds a honeytail.truncated field to its event. Defaults to truncate." yaml:"long_lines,omitempty"`
+	IdleTimeout           uint   `long:"idle_timeout" description:"Close a file that has had no new lines for this many seconds, saving its position first, and reopen it when it changes. Files that are deleted are always closed once they have been read to the end. 0 means files stay open." yaml:"idle_timeout,omitempty"`
 }
 
 // Statefile mechanics when ReadFrom is 'last'
@@ -45,6 +92,8 @@ type TailOptions struct {
 // empty statefile => ReadFrom = end
 // permission denied => WARN and ReadFrom = end
 // invalid location (aka logfile's been rotated) => ReadFrom = beginning
+// different fingerprint (aka a different file with the same name) => ReadFrom = beginning
+// offset past EOF or smaller file (aka logfile's been truncated) => ReadFrom = beginning
 
 type Config struct {
 	// Path to the log file to tail
@@ -57,18 +106,53 @@ type Config struct {
 	Type RotateStyle
 	// Tail specific options
 	Options TailOptions
+
+	// StartOffsets has where to start reading particular files, overriding
+	// ReadFrom and any statefile, eg. to skip ahead to --backfill_start
+	StartOffsets map[string]int64
 }
 
+// fingerprintBytes is how much of the start of a logfile gets checksummed to
+// recognize it again after a restart
+const fingerprintBytes = 1024
+
 // State is what's stored in a statefile
 type State struct {
 	INode  uint64 // the inode
 	Offset int64
+	// Size is the size of the logfile when the state was saved
+	Size int64 `json:",omitempty"`
+	// Checksum is the hex encoded sha256 of the first ChecksumBytes of the
+	// logfile. Statefiles written by older versions don't have one.
+	Checksum      string `json:",omitempty"`
+	ChecksumBytes int64  `json:",omitempty"`
+	// Rotated are the older files of the logfile's rotation series that
+	// have been read, with --tail.ordered
+	Rotated []RotatedFile `json:",omitempty"`
+}
+
+// readStateFile returns the state saved in stateFile, and false if there
+// isn't any
+func readStateFile(stateFile string) (State, bool) {
+	var state State
+	content, err := os.ReadFile(stateFile)
+	if err != nil {
+		return state, false
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return State{}, false
+	}
+	return state, true
 }
 
+// stateFileWrites is held to change part of a statefile that's written from
+// more than one place
+var stateFileWrites sync.Mutex
+
 // GetSampledEntries wraps GetEntries and returns a list of channels that
 // provide sampled entries. If rng is non-nil it will be used for sampling
 // decisions; otherwise the global math/rand source is used.
-func GetSampledEntries(ctx context.Context, conf Config, sampleRate uint, rng *rand.Rand) ([]chan string, error) {
+func GetSampledEntries(ctx context.Context, conf Config, sampleRate uint, rng *rand.Rand) ([]chan event.Line, error) {
 	unsampledLinesChans, err := GetEntries(ctx, conf)
 	if err != nil {
 		return nil, err
@@ -77,28 +161,34 @@ func GetSampledEntries(ctx context.Context, conf Config, sampleRate uint, rng *r
 		return unsampledLinesChans, nil
 	}
 
-	sampledLinesChans := make([]chan string, 0, len(unsampledLinesChans))
+	sampledLinesChans := make([]chan event.Line, 0, len(unsampledLinesChans))
 
 	for _, lines := range unsampledLinesChans {
-		sampledLines := make(chan string)
-		go func(pLines chan string) {
-			defer close(sampledLines)
-			for line := range pLines {
-				if shouldDrop(sampleRate, rng) {
-					logrus.WithFields(logrus.Fields{
-						"line":       line,
-						"samplerate": sampleRate,
-					}).Debug("Sampler says skip this line")
-				} else {
-					sampledLines <- line
-				}
-			}
-		}(lines)
-		sampledLinesChans = append(sampledLinesChans, sampledLines)
+		sampledLinesChans = append(sampledLinesChans, SampleLines(lines, sampleRate, rng))
 	}
 	return sampledLinesChans, nil
 }
 
+// SampleLines returns a channel that gets a sample of the lines read from
+// lines, and is closed when lines is closed.
+func SampleLines(lines chan event.Line, sampleRate uint, rng *rand.Rand) chan event.Line {
+	sampledLines := make(chan event.Line)
+	go func() {
+		defer close(sampledLines)
+		for line := range lines {
+			if shouldDrop(sampleRate, rng) {
+				logrus.WithFields(logrus.Fields{
+					"line":       line.Text,
+					"samplerate": sampleRate,
+				}).Debug("Sampler says skip this line")
+			} else {
+				sampledLines <- line
+			}
+		}
+	}()
+	return sampledLines
+}
+
 // shouldDrop returns true if the line should be dropped
 // false if it should be kept
 // if sampleRate is 5,
@@ -112,50 +202,271 @@ func shouldDrop(rate uint, rng *rand.Rand) bool {
 
 // GetEntries sets up a list of channels that get one line at a time from each
 // file down each channel.
-func GetEntries(ctx context.Context, conf Config) ([]chan string, error) {
-	if conf.Type != RotateStyleSyslog {
-		return nil, errors.New("Only Syslog style rotation currently supported")
+func GetEntries(ctx context.Context, conf Config) ([]chan event.Line, error) {
+	reading, err := parseLineOptions(conf.Options)
+	if err != nil {
+		return nil, err
 	}
-	// expand any globs in the list of files so our list all represents real files
-	var filenames []string
-	for _, filePath := range conf.Paths {
-		if filePath == "-" {
-			filenames = append(filenames, filePath)
-		} else {
-			files, err := filepath.Glob(filePath)
-			if err != nil {
-				return nil, err
-			}
-			files = removeStateFiles(files, conf)
-			files = removeFilteredPaths(files, conf.FilterPaths)
-			filenames = append(filenames, files...)
+	switch conf.Type {
+	case RotateStyleSyslog:
+		if conf.Options.Ordered {
+			return getOrderedEntries(ctx, conf, reading)
 		}
+	case RotateStyleTimestamp:
+		if conf.Options.Ordered {
+			return nil, errors.New("Reading files in order is only supported with syslog style rotation")
+		}
+		return getTimestampEntries(ctx, conf, reading)
+	default:
+		return nil, errors.New("Unknown log rotation style")
+	}
+	filenames, err := expandPaths(conf)
+	if err != nil {
+		return nil, err
 	}
 	if len(filenames) == 0 {
 		return nil, errors.New("After removing missing files and state files from the list, there are no files left to tail")
 	}
 
 	// make our lines channel list; we'll get one channel for each file
-	linesChans := make([]chan string, 0, len(filenames))
+	linesChans := make([]chan event.Line, 0, len(filenames))
 	numFiles := len(filenames)
 	for _, file := range filenames {
-		var lines chan string
+		var lines chan event.Line
 		if file == "-" {
-			lines = tailStdIn(ctx)
+			lines = tailStdIn(ctx, conf.Options.MaxLineBytes)
+		} else if IsCompressed(file) {
+			var err error
+			if lines, err = tailCompressedFile(ctx, file, conf.Options.MaxLineBytes); err != nil {
+				return nil, err
+			}
 		} else {
 			stateFile := getStateFile(conf, file, numFiles)
 			tailer, err := getTailer(conf, file, stateFile)
 			if err != nil {
 				return nil, err
 			}
-			lines = tailSingleFile(ctx, tailer, file, stateFile)
+			lines = tailSingleFile(ctx, conf, tailer, file, stateFile)
 		}
-		linesChans = append(linesChans, lines)
+		linesChans = append(linesChans, readLines(lines, reading))
 	}
 
 	return linesChans, nil
 }
 
+// expandPaths expands any globs in conf.Paths so the list all represents real
+// files, leaving out statefiles and filtered paths. "-" for STDIN is passed
+// through unchanged.
+func expandPaths(conf Config) ([]string, error) {
+	var filenames []string
+	for _, filePath := range conf.Paths {
+		if filePath == "-" {
+			filenames = append(filenames, filePath)
+		} else {
+			files, err := filepath.Glob(filePath)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, filterFiles(files, conf)...)
+		}
+	}
+	return filenames, nil
+}
+
+// filterFiles removes files that shouldn't be tailed from the list: statefiles,
+// files matching --filter-file, and compressed files unless --tail.stop is set.
+func filterFiles(files []string, conf Config) []string {
+	files = removeStateFiles(files, conf)
+	files = removeFilteredPaths(files, conf.FilterPaths)
+	if !conf.Options.Stop {
+		files = removeCompressedFiles(files)
+	}
+	return files
+}
+
+// getTimestampEntries sets up one channel for each entry in conf.Paths. Each
+// path is a glob describing a series of timestamp-rotated files; the channel
+// gets lines from the newest file in the series, moving on to newer files as
+// they appear.
+func getTimestampEntries(ctx context.Context, conf Config, reading lineOptions) ([]chan event.Line, error) {
+	linesChans := make([]chan event.Line, 0, len(conf.Paths))
+	for _, pattern := range conf.Paths {
+		if pattern == "-" {
+			linesChans = append(linesChans, readLines(tailStdIn(ctx, conf.Options.MaxLineBytes), reading))
+			continue
+		}
+		file, err := newestMatch(conf, pattern, "")
+		if err != nil {
+			return nil, err
+		}
+		if file == "" {
+			continue
+		}
+		linesChans = append(linesChans, readLines(tailTimestampFiles(ctx, conf, pattern, file), reading))
+	}
+	if len(linesChans) == 0 {
+		return nil, errors.New("After removing missing files and state files from the list, there are no files left to tail")
+	}
+	return linesChans, nil
+}
+
+// newestMatch expands pattern and returns the matching file whose name sorts
+// last, provided it sorts after current. It returns the empty string if there
+// is no such file.
+func newestMatch(conf Config, pattern string, current string) (string, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	// the live end of a series is never compressed
+	files = removeCompressedFiles(removeStateFiles(files, conf))
+	files = removeFilteredPaths(files, conf.FilterPaths)
+	if len(files) == 0 {
+		return "", nil
+	}
+	sort.Strings(files)
+	newest := files[len(files)-1]
+	if newest <= current {
+		return "", nil
+	}
+	return newest, nil
+}
+
+// tailTimestampFiles tails file, a member of the series of files matching
+// pattern. Once a newer file in the series appears, it finishes reading the
+// current file and then switches to the newer one. Each file in the series
+// keeps its own statefile.
+func tailTimestampFiles(ctx context.Context, conf Config, pattern string, file string) chan event.Line {
+	lines := make(chan event.Line)
+	go func() {
+		defer close(lines)
+		fileConf := conf
+		for {
+			// a timestamp-rotated series always spans multiple files, so
+			// statefiles are derived from each file's name
+			stateFile := getStateFile(fileConf, file, 2)
+			tailer, err := getTailer(fileConf, file, stateFile)
+			if err != nil {
+				logrus.WithError(err).WithField("file", file).
+					Error("unable to tail file")
+				return
+			}
+			// keep track of how far into the file we've read
+			offset := getStartOffset(tailer)
+			done := make(chan struct{})
+			newer := make(chan string, 1)
+			go watchForNewerFile(ctx, conf, pattern, file, newer, done)
+			fileLines := tailSingleFile(ctx, fileConf, tailer, file, stateFile)
+			var next string
+		ReadLines:
+			for {
+				select {
+				case line, ok := <-fileLines:
+					if !ok {
+						break ReadLines
+					}
+					offset = line.Offset
+					lines <- line
+				case next = <-newer:
+					// the tailer may have been replaced if the file was
+					// closed while idle, so stop it by name
+					StopFile(file)
+				}
+			}
+			close(done)
+			if ctx.Err() != nil || next == "" {
+				// cancelled, or the tailer stopped on its own because of
+				// --tail.stop
+				return
+			}
+			// the tailer only sends complete lines and may not have seen the
+			// last writes to the old file, so read whatever is left directly
+			readRemainingLines(ctx, file, offset, conf.Options.MaxLineBytes, lines)
+			logrus.WithFields(logrus.Fields{
+				"previous": file,
+				"file":     next,
+			}).Info("switching to newer file in rotated series")
+			file = next
+			// newer files in the series are always read in full
+			fileConf.Options.ReadFrom = "beginning"
+		}
+	}()
+	return lines
+}
+
+// watchForNewerFile checks pattern for a file newer than file, sending the
+// name on newer when it finds one.
+func watchForNewerFile(ctx context.Context, conf Config, pattern string, file string,
+	newer chan<- string, done <-chan struct{}) {
+	ticker := time.NewTicker(rotateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		next, err := newestMatch(conf, pattern, file)
+		if err != nil {
+			logrus.WithError(err).WithField("pattern", pattern).
+				Warn("unable to check for newer rotated files")
+			continue
+		}
+		if next != "" {
+			newer <- next
+			return
+		}
+	}
+}
+
+// readRemainingLines sends every line in file after offset, including a final
+// line with no trailing newline.
+func readRemainingLines(ctx context.Context, file string, offset int64, maxBytes int, lines chan<- event.Line) {
+	fh, err := os.Open(file)
+	if err != nil {
+		logrus.WithError(err).WithField("file", file).
+			Warn("unable to reopen rotated file to finish reading it")
+		return
+	}
+	defer fh.Close()
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+		logrus.WithError(err).WithField("file", file).
+			Warn("unable to seek in rotated file to finish reading it")
+		return
+	}
+	sendLines(ctx, fh, file, offset, maxBytes, lines)
+}
+
+// sendLines sends every line read from r, including a final line with no
+// trailing newline. source and offset say where r is reading from, to set
+// each line's Source and Offset. No more than maxBytes+1 bytes of a line are
+// kept when maxBytes is set. It returns nil once r is exhausted or ctx is
+// cancelled.
+func sendLines(ctx context.Context, r io.Reader, source string, offset int64, maxBytes int, lines chan<- event.Line) error {
+	ctx, stop := fileContext(ctx, source)
+	defer stop()
+	reader := bufio.NewReader(r)
+	for {
+		text, read, err := readLimitedLine(reader, maxBytes)
+		offset += read
+		if read > 0 || err == nil {
+			line := event.Line{Text: text, Source: source, Offset: offset}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
 // removeStateFiles goes through the list of files and removes any that appear
 // to be statefiles to avoid .leash.state.leash.state.leash.state from appearing
 // when you use an overly permissive glob
@@ -209,59 +520,358 @@ func removeFilteredPaths(files []string, filteredPaths []string) []string {
 	return newFiles
 }
 
-func tailSingleFile(ctx context.Context, tailer *tail.Tail, file string, stateFile string) chan string {
-	lines := make(chan string)
-	// TODO report some metric to indicate whether we're keeping up with the
-	// front of the file, of if it's being written faster than we can send
-	// events
+func tailSingleFile(ctx context.Context, conf Config, tailer *tail.Tail, file string, stateFile string) chan event.Line {
+	lines := make(chan event.Line)
 
-	stateFh, err := os.OpenFile(stateFile, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"logfile":   file,
-			"statefile": stateFile,
-		}).Warn("Failed to open statefile for writing. File location will not be saved.")
+	var stateFh *os.File
+	if conf.Options.CommitOnAck {
+		// the statefile gets written by CommitOffset once the events from
+		// these lines have been acknowledged, rather than once per second
+		registerStateFile(file, stateFile)
+	} else {
+		var err error
+		stateFh, err = os.OpenFile(stateFile, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"logfile":   file,
+				"statefile": stateFile,
+			}).Warn("Failed to open statefile for writing. File location will not be saved.")
+		}
 	}
 
-	ticker := time.NewTicker(time.Second)
+	// sent is the offset of the last line handed off, to check how far
+	// behind the end of the file we are
+	var sent atomic.Int64
+	sent.Store(getStartOffset(tailer))
+	// current is the tailer reading the file, or nil while it's closed
+	var current atomic.Pointer[openFile]
+	current.Store(newOpenFile(tailer, file))
+	done := make(chan struct{})
+	var stateLock sync.Mutex
 	state := State{}
+	if saved, ok := readStateFile(stateFile); ok {
+		// the rest is written afresh
+		state.Rotated = saved.Rotated
+	}
 	go func() {
-		for range ticker.C {
-			updateStateFile(&state, tailer, file, stateFh)
+		ticker := time.NewTicker(lagCheckInterval)
+		defer ticker.Stop()
+		defer forgetBytesBehind(file)
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			recordBytesBehind(file, sent.Load())
+			if o := current.Load(); stateFh != nil && o != nil && o.isNamed(file) {
+				stateLock.Lock()
+				updateStateFile(&state, o.tailer, file, stateFh)
+				stateLock.Unlock()
+			}
 		}
 	}()
 
 	go func() {
+		ctx, stop := fileContext(ctx, file)
+		defer stop()
+		offset := sent.Load()
+		// sentAny is whether any lines have been sent, to be committed
+		sentAny := false
+		// with --tail.stop the tailer finishes at the end of the file by
+		// itself, otherwise check now and then whether to close the file
+		var check <-chan time.Time
+		if !conf.Options.Stop {
+			ticker := time.NewTicker(idleCheckInterval)
+			defer ticker.Stop()
+			check = ticker.C
+		}
+		idleTimeout := time.Duration(conf.Options.IdleTimeout) * time.Second
+		lastLine := time.Now()
+		// quiet is whether no lines have come since the last check
+		quiet := false
 	ReadLines:
 		for {
+			// why the file is being closed, if it is
+			var closing string
 			select {
 			case line, ok := <-tailer.Lines:
 				if !ok {
-					// tailer.Lines is closed
-					break ReadLines
+					// tailer.Lines is closed. The tailer stops when the file
+					// is moved or deleted rather than reopening it itself,
+					// so the offsets of the new file's lines start over
+					// here. A tailer that gave up because of an error is
+					// replaced once the file changes too. With
+					// --tail.discover_files the new file is found again as
+					// a file of its own instead.
+					if check == nil || ctx.Err() != nil {
+						break ReadLines
+					}
+					rotated := tailer.Err() == nil
+					if conf.Options.DiscoverFiles {
+						if rotated {
+							// the file at this name isn't the one read
+							current.Store(nil)
+						}
+						break ReadLines
+					}
+					if rotated && conf.Type == RotateStyleTimestamp {
+						// files in a timestamp-rotated series are never
+						// recreated under the same name, so there's nothing
+						// to reopen
+						break ReadLines
+					}
+					closing = "failed"
+					if rotated {
+						closing = "rotated"
+					}
+					break
 				}
 				if line.Err != nil {
 					// skip errored lines
 					continue
 				}
-				lines <- line.Text
+				// the tailer starts over from the beginning when it reopens a
+				// truncated file, which shows up as its position going
+				// backwards. A position of 0 means it has no file open.
+				if pos, err := tailer.Tell(); err == nil && pos > 0 && pos < offset {
+					offset = 0
+				}
+				offset += int64(len(line.Text)) + 1
+				text := line.Text
+				if max := conf.Options.MaxLineBytes; max > 0 && len(text) > max {
+					// keep one byte more than the limit, like
+					// readLimitedLine, so lines that were too long still are
+					text = text[:max+1]
+				}
+				select {
+				case lines <- event.Line{Text: text, Source: file, Offset: offset}:
+				case <-ctx.Done():
+					break ReadLines
+				}
+				sent.Store(offset)
+				sentAny = true
+				lastLine = time.Now()
+				quiet = false
+				continue
+			case <-check:
+				_, err := os.Stat(file)
+				// a deleted file has been read to the end once the tailer
+				// has had nothing to send for a whole check
+				if os.IsNotExist(err) && quiet {
+					closing = "deleted"
+				} else if err == nil && quiet && !current.Load().isNamed(file) {
+					// the tailer can miss the file being moved, eg. when
+					// the move and the new file come at once, so it's
+					// closed here once it has read all of the old file
+					if conf.Options.DiscoverFiles || conf.Type == RotateStyleTimestamp {
+						closeTailer(tailer)
+						tailer = nil
+						current.Store(nil)
+						break ReadLines
+					}
+					closing = "rotated"
+				} else if idleTimeout > 0 && time.Since(lastLine) >= idleTimeout {
+					closing = "idle"
+				}
+				quiet = true
+				if closing == "" {
+					continue
+				}
 			case <-ctx.Done():
-				// will only trigger when the context is cancelled
+				// will only trigger when the context is cancelled or
+				// StopFile is called
+				break ReadLines
+			}
+			// any lines the tailer read after the last one sent are thrown
+			// away, and read again once the file is reopened
+			opened := current.Load()
+			closeTailer(tailer)
+			current.Store(nil)
+			// a rotated file's offset doesn't go with the file at its name
+			if stateFh != nil && closing != "rotated" {
+				stateLock.Lock()
+				writeStateFile(&state, file, offset, stateFh)
+				stateLock.Unlock()
+			}
+			if closing == "rotated" && conf.Options.Ordered {
+				// it's one of the older files of the series now, and it's
+				// been read to the end
+				if stateFh != nil {
+					stateLock.Lock()
+					state.addRotated()
+					stateLock.Unlock()
+				} else if err := recordRotatedAway(stateFile); err != nil {
+					logrus.WithError(err).WithField("statefile", stateFile).
+						Warn("unable to record reading rotated file in the statefile")
+				}
+			}
+			switch closing {
+			case "rotated":
+				logrus.WithField("file", file).
+					Info("file was moved or deleted, will read the file that replaces it from the beginning")
+			case "failed":
+				logrus.WithError(tailer.Err()).WithField("file", file).
+					Warn("stopped tailing file, will reopen it when it changes")
+			case "deleted":
+				logrus.WithField("file", file).Info("file was deleted, closed it after reading to the end")
+			case "idle":
+				logrus.WithFields(logrus.Fields{
+					"file":   file,
+					"offset": offset,
+				}).Info("no new lines for --tail.idle_timeout, closed file until it changes")
+			}
+			interval := idleCheckInterval
+			if closing == "rotated" {
+				interval = replacedCheckInterval
+			}
+			reopened, from, ok := reopenTailer(ctx, conf, file, stateFile, offset, opened.info, interval)
+			if !ok {
+				tailer = nil
 				break ReadLines
 			}
+			logrus.WithFields(logrus.Fields{
+				"file":   file,
+				"offset": from,
+			}).Info("file changed, reopened it")
+			tailer = reopened
+			current.Store(newOpenFile(tailer, file))
+			offset = from
+			sent.Store(offset)
+			lastLine = time.Now()
+			quiet = false
+		}
+		if ctx.Err() != nil && tailer != nil {
+			// the tailer blocks sending lines nobody reads, so keep
+			// draining them until it notices it's been killed
+			tailer.Kill(nil)
+			go func() {
+				for range tailer.Lines {
+				}
+			}()
+		}
+		close(done)
+		if o := current.Load(); stateFh != nil && o != nil && o.isNamed(file) {
+			stateLock.Lock()
+			updateStateFile(&state, o.tailer, file, stateFh)
+			stateLock.Unlock()
 		}
+		if stateFh != nil {
+			stateFh.Close()
+		}
+		if conf.Options.CommitOnAck {
+			closeStateFile(file, stateFile, sent.Load(), sentAny)
+		}
+		// the statefile is done with once the lines stop
 		close(lines)
-		ticker.Stop()
-		updateStateFile(&state, tailer, file, stateFh)
-		stateFh.Close()
 	}()
 	return lines
 }
 
+// openFile is a tailer reading a file, and what the file looked like when it
+// was opened
+type openFile struct {
+	tailer *tail.Tail
+	info   os.FileInfo
+}
+
+func newOpenFile(tailer *tail.Tail, file string) *openFile {
+	info, _ := os.Stat(file)
+	return &openFile{tailer: tailer, info: info}
+}
+
+// isNamed is whether file is still the name of the open file, rather than of
+// a file that replaced it
+func (o *openFile) isNamed(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && o.info != nil && os.SameFile(info, o.info)
+}
+
+// closeTailer stops tailer and waits for it to close its file
+func closeTailer(tailer *tail.Tail) {
+	tailer.Kill(nil)
+	go func() {
+		for range tailer.Lines {
+		}
+	}()
+	tailer.Wait()
+}
+
+// reopenTailer waits for file to change after the file opened as opened was
+// closed at offset, checking every interval, and starts a new tailer for it. A file that was replaced
+// by a new one is read from the beginning, and so is one that was truncated.
+// It returns false if ctx is done first, or with --tail.discover_files if
+// file is deleted or replaced, since then the new file is tailed as a file of
+// its own.
+func reopenTailer(ctx context.Context, conf Config, file string, stateFile string, offset int64, opened os.FileInfo, interval time.Duration) (*tail.Tail, int64, bool) {
+	// remember what the file looked like to tell if it gets replaced. If
+	// file already names another file, it has been.
+	var closed os.FileInfo
+	var checksum string
+	var checksumBytes int64
+	if info, err := os.Stat(file); err == nil && opened != nil && os.SameFile(info, opened) {
+		closed = info
+		checksum, checksumBytes, _ = getFingerprint(file, min(offset, fingerprintBytes))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// the file that replaced a rotated one may be there already
+	for waiting := closed != nil; ; waiting = true {
+		if waiting {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil, 0, false
+			}
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) && conf.Options.DiscoverFiles {
+				return nil, 0, false
+			}
+			continue
+		}
+		replaced := closed == nil || !os.SameFile(info, closed)
+		if !replaced && info.Size() == offset {
+			// nothing new to read
+			continue
+		}
+		if !replaced {
+			// the inode may have been reused by a new file
+			current, _, err := getFingerprint(file, checksumBytes)
+			replaced = err != nil || current != checksum
+		}
+		from := offset
+		if replaced || info.Size() < offset {
+			if replaced && conf.Options.DiscoverFiles {
+				return nil, 0, false
+			}
+			from = 0
+		}
+		reopenConf := conf
+		reopenConf.StartOffsets = map[string]int64{file: from}
+		tailer, err := getTailer(reopenConf, file, stateFile)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).Warn("unable to reopen file")
+			continue
+		}
+		return tailer, from, true
+	}
+}
+
+// getStartOffset returns the offset in the file the tailer started reading
+// from
+func getStartOffset(tailer *tail.Tail) int64 {
+	if tailer.Location == nil {
+		return 0
+	}
+	return tailer.Location.Offset
+}
+
 // tailStdIn is a special case to tail STDIN without any of the
 // fancy stuff that the tail module provides
-func tailStdIn(ctx context.Context) chan string {
-	lines := make(chan string)
+func tailStdIn(ctx context.Context, maxBytes int) chan event.Line {
+	lines := make(chan event.Line)
 	input := bufio.NewReader(os.Stdin)
 	go func() {
 		defer close(lines)
@@ -272,19 +882,15 @@ func tailStdIn(ctx context.Context) chan string {
 				return
 			default:
 			}
-			line, partialLine, err := input.ReadLine()
+			line, read, err := readLimitedLine(input, maxBytes)
+			if read > 0 {
+				lines <- event.Line{Text: strings.TrimSuffix(line, "\r")}
+			}
 			if err != nil {
 				logrus.Debug("stdin is closed")
 				// bail when STDIN closes
 				return
 			}
-			var parts []string
-			parts = append(parts, string(line))
-			for partialLine {
-				line, partialLine, _ = input.ReadLine()
-				parts = append(parts, string(line))
-			}
-			lines <- strings.Join(parts, "")
 		}
 	}()
 	return lines
@@ -329,12 +935,46 @@ func getStartLocation(stateFile string, logfile string) *tail.SeekInfo {
 		}).Debug("getStartLocation failed to get unix.stat() on the logfile")
 		return end
 	}
-	// compare inode numbers of the last-seen and existing log files
 	if state.INode != uint64(logStat.Ino) {
+		// a new file, even if it starts the same way as the last one, eg.
+		// with a header. Only a copy of the file that was being read, with
+		// the same fingerprint and the same size, is read on from the offset.
+		copied := false
+		if state.Checksum != "" && state.Size > 0 && logStat.Size == state.Size {
+			checksum, checksumBytes, err := getFingerprint(logfile, state.ChecksumBytes)
+			copied = err == nil && checksum == state.Checksum && checksumBytes == state.ChecksumBytes
+		}
+		if !copied {
+			logrus.WithFields(logrus.Fields{
+				"starting at": "beginning",
+			}).Debug("getStartLocation found a different inode number for the logfile")
+			// file's been rotated
+			return beginning
+		}
+	} else if state.Checksum != "" {
+		// compare the fingerprints of the last-seen and existing log files.
+		// Statefiles from older versions only have the inode to go on.
+		checksum, checksumBytes, err := getFingerprint(logfile, state.ChecksumBytes)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"starting at": "end", "error": err,
+			}).Debug("getStartLocation failed to fingerprint the logfile")
+			return end
+		}
+		if checksum != state.Checksum || checksumBytes != state.ChecksumBytes {
+			logrus.WithFields(logrus.Fields{
+				"starting at": "beginning",
+			}).Debug("getStartLocation found a different fingerprint for the logfile")
+			// file's been rotated and the inode reused
+			return beginning
+		}
+	}
+	if state.Offset > logStat.Size || logStat.Size < state.Size {
 		logrus.WithFields(logrus.Fields{
-			"starting at": "beginning", "error": err,
-		}).Debug("getStartLocation found a different inode number for the logfile")
-		// file's been rotated
+			"starting at": "beginning",
+			"offset":      state.Offset,
+			"size":        logStat.Size,
+		}).Debug("getStartLocation found the logfile has been truncated")
 		return beginning
 	}
 	logrus.WithFields(logrus.Fields{
@@ -352,7 +992,7 @@ func getStartLocation(stateFile string, logfile string) *tail.SeekInfo {
 func getTailer(conf Config, file string, stateFile string) (*tail.Tail, error) {
 	// tail a real file
 	var loc *tail.SeekInfo // 0 value means start at beginning
-	var reOpen, follow bool = true, true
+	var follow bool = true
 	var readFrom = conf.Options.ReadFrom
 	if readFrom == "" {
 		readFrom = "last"
@@ -371,13 +1011,28 @@ func getTailer(conf Config, file string, stateFile string) (*tail.Tail, error) {
 		errMsg := fmt.Sprintf("unknown option to --read_from: %s", readFrom)
 		return nil, errors.New(errMsg)
 	}
+	if offset, ok := conf.StartOffsets[file]; ok {
+		loc = &tail.SeekInfo{
+			Offset: offset,
+			Whence: io.SeekStart,
+		}
+	}
 	if conf.Options.Stop {
-		reOpen = false
 		follow = false
 	}
+	// use an absolute offset so we know exactly where in the file the tailer
+	// started, to work out the offset of each line
+	if loc != nil && loc.Whence == io.SeekEnd {
+		if info, err := os.Stat(file); err == nil {
+			loc = &tail.SeekInfo{
+				Offset: info.Size() + loc.Offset,
+				Whence: io.SeekStart,
+			}
+		}
+	}
 	tailConf := tail.Config{
 		Location:  loc,
-		ReOpen:    reOpen, // keep reading on rotation, aka tail -F
+		ReOpen:    false,  // stop on rotation, tailSingleFile reopens the file
 		MustExist: true,   // fail if log file doesn't exist
 		Follow:    follow, // don't stop at EOF, aka tail -f
 		Logger:    tail.DiscardingLogger,
@@ -433,16 +1088,33 @@ func getStateFile(conf Config, filename string, numFiles int) string {
 }
 
 // updateStateFile updates the state file once per second with the current
-// values for the logfile's inode number and offset
+// values for the logfile's inode number, size, fingerprint and offset
 func updateStateFile(state *State, t *tail.Tail, file string, stateFh *os.File) {
+	currentPos, err := t.Tell()
+	if err != nil {
+		return
+	}
+	writeStateFile(state, file, currentPos, stateFh)
+}
+
+// writeStateFile records offset in the statefile, along with the logfile's
+// current inode number, size and fingerprint
+func writeStateFile(state *State, file string, offset int64, stateFh *os.File) {
 	logStat := unix.Stat_t{}
 	unix.Stat(file, &logStat)
-	currentPos, err := t.Tell()
+	checksum, checksumBytes, err := getFingerprint(file, fingerprintBytes)
 	if err != nil {
 		return
 	}
+	if offset > logStat.Size {
+		// the last line of a file with no trailing newline
+		offset = logStat.Size
+	}
 	state.INode = uint64(logStat.Ino)
-	state.Offset = currentPos
+	state.Offset = offset
+	state.Size = logStat.Size
+	state.Checksum = checksum
+	state.ChecksumBytes = checksumBytes
 	out, err := json.Marshal(state)
 	if err != nil {
 		return
@@ -452,3 +1124,190 @@ func updateStateFile(state *State, t *tail.Tail, file string, stateFh *os.File)
 	stateFh.WriteAt(out, 0)
 	stateFh.Sync()
 }
+
+// bytesBehind has how many bytes of each file being tailed are left to read,
+// as of the last check
+var bytesBehind = struct {
+	sync.Mutex
+	m map[string]int64
+}{m: make(map[string]int64)}
+
+// recordBytesBehind compares offset with the size of file
+func recordBytesBehind(file string, offset int64) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	behind := info.Size() - offset
+	if behind < 0 {
+		// the file's been truncated or replaced, and the tailer will start
+		// over from the beginning
+		behind = info.Size()
+	}
+	bytesBehind.Lock()
+	defer bytesBehind.Unlock()
+	bytesBehind.m[file] = behind
+}
+
+// forgetBytesBehind stops reporting on file once it's no longer tailed
+func forgetBytesBehind(file string) {
+	bytesBehind.Lock()
+	defer bytesBehind.Unlock()
+	delete(bytesBehind.m, file)
+}
+
+// BytesBehind returns how many bytes are left to read in each file that's
+// being tailed, as of the last check. Files are checked once per second.
+func BytesBehind() map[string]int64 {
+	bytesBehind.Lock()
+	defer bytesBehind.Unlock()
+	behind := make(map[string]int64, len(bytesBehind.m))
+	for file, n := range bytesBehind.m {
+		behind[file] = n
+	}
+	return behind
+}
+
+// fileStopper stops reading one file
+type fileStopper struct {
+	cancel context.CancelFunc
+}
+
+// fileStoppers has the fileStopper for each file that's being read
+var fileStoppers = struct {
+	sync.Mutex
+	m map[string]*fileStopper
+}{m: make(map[string]*fileStopper)}
+
+// fileContext returns a context for reading file that is done when ctx is, or
+// when StopFile is called for file. Call stop once done reading file.
+func fileContext(ctx context.Context, file string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopper := &fileStopper{cancel: cancel}
+	fileStoppers.Lock()
+	defer fileStoppers.Unlock()
+	fileStoppers.m[file] = stopper
+	return ctx, func() {
+		fileStoppers.Lock()
+		defer fileStoppers.Unlock()
+		// the file may have been opened again since
+		if fileStoppers.m[file] == stopper {
+			delete(fileStoppers.m, file)
+		}
+		cancel()
+	}
+}
+
+// StopFile stops reading file, closing the channel its lines are sent on as
+// if it had ended. Lines from file that were already read may still be sent.
+// Stopping the current file in a timestamp-rotated series stops the series;
+// with --tail.ordered, the next file in the series is read instead. It is a
+// no-op for files that aren't being read.
+func StopFile(file string) {
+	fileStoppers.Lock()
+	defer fileStoppers.Unlock()
+	if stopper, ok := fileStoppers.m[file]; ok {
+		stopper.cancel()
+	}
+}
+
+// ackedStateFile is the statefile of a file tailed with --tail.commit_on_ack
+type ackedStateFile struct {
+	path string
+	// closed is set once the file isn't being read any more, and last is the
+	// offset of the last line sent from it then
+	closed bool
+	last   int64
+}
+
+// stateFiles maps each file tailed with --tail.commit_on_ack to its statefile
+var stateFiles = struct {
+	sync.Mutex
+	m map[string]*ackedStateFile
+}{m: make(map[string]*ackedStateFile)}
+
+// registerStateFile records which statefile CommitOffset should write for file
+func registerStateFile(file string, stateFile string) {
+	stateFiles.Lock()
+	defer stateFiles.Unlock()
+	stateFiles.m[file] = &ackedStateFile{path: stateFile}
+}
+
+// closeStateFile records that file isn't being read any more, so its
+// statefile can be forgotten once the offset of its last line is committed.
+// sentAny is whether any lines were sent from it at all.
+func closeStateFile(file string, stateFile string, last int64, sentAny bool) {
+	stateFiles.Lock()
+	defer stateFiles.Unlock()
+	// the file may have been opened again since
+	s, ok := stateFiles.m[file]
+	if !ok || s.path != stateFile {
+		return
+	}
+	if !sentAny {
+		// there's nothing to commit
+		delete(stateFiles.m, file)
+		return
+	}
+	s.closed = true
+	s.last = last
+}
+
+// ForgetClosedFile forgets the statefile of file once it isn't being read any
+// more and committed, the offset last committed for it, has reached its last
+// line. CommitOffset is a no-op for it after that. It returns whether file
+// has no statefile now.
+func ForgetClosedFile(file string, committed int64) bool {
+	stateFiles.Lock()
+	defer stateFiles.Unlock()
+	s, ok := stateFiles.m[file]
+	if !ok {
+		return true
+	}
+	if !s.closed || committed < s.last {
+		return false
+	}
+	delete(stateFiles.m, file)
+	return true
+}
+
+// CommitOffset records offset as the position to pick up from in the
+// statefile of file, which must be tailed with --tail.commit_on_ack. It is a
+// no-op for files without a statefile, like STDIN and compressed files.
+func CommitOffset(file string, offset int64) error {
+	stateFiles.Lock()
+	s, ok := stateFiles.m[file]
+	stateFiles.Unlock()
+	if !ok {
+		return nil
+	}
+	stateFile := s.path
+	stateFh, err := os.OpenFile(stateFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer stateFh.Close()
+	stateFileWrites.Lock()
+	defer stateFileWrites.Unlock()
+	// keep the files of an ordered series that have been read
+	state, _ := readStateFile(stateFile)
+	writeStateFile(&state, file, offset, stateFh)
+	return nil
+}
+
+// getFingerprint returns the hex encoded sha256 of the first n bytes of file,
+// along with how many bytes were checksummed, which is less than n if the file
+// is shorter than that.
+func getFingerprint(file string, n int64) (string, int64, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	read, err := io.Copy(h, io.LimitReader(fh, n))
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), read, nil
+}
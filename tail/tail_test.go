@@ -3,6 +3,7 @@ package tail
 import (
 	"context"
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -15,6 +16,10 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tenebris-tech/tail"
+	"golang.org/x/sys/unix"
+
+	"github.com/honeycombio/honeytail/event"
 )
 
 // lockedSource wraps a rand.Source to make it safe for concurrent use.
@@ -61,7 +66,7 @@ func TestTailSingleFile(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	lines := tailSingleFile(ts.ctx, tailer, filename, statefilename)
+	lines := tailSingleFile(ts.ctx, conf, tailer, filename, statefilename)
 	checkLinesChan(t, lines, jsonLines)
 }
 
@@ -218,6 +223,103 @@ func TestAbortChannel(t *testing.T) {
 	}
 }
 
+func TestStartOffsetsAndStopFile(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	filename := ts.tmpdir + "/app.log"
+	ts.writeFile(t, filename, "one\ntwo\nthree\nfour\n")
+	conf := Config{
+		Paths: []string{filename},
+		Options: TailOptions{
+			ReadFrom:  "start",
+			StateFile: ts.tmpdir + "/app.leash.state",
+		},
+		StartOffsets: map[string]int64{filename: 4},
+	}
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := expectLine(t, chanArr[0], "two")
+	if line.Offset != 8 {
+		t.Errorf("got offset %d, expected 8", line.Offset)
+	}
+	// the file is still being followed, but nobody reads the rest of its
+	// lines once it's stopped
+	StopFile(filename)
+	checkLinesChanClosed(t, chanArr[0])
+	StopFile(filename)
+}
+
+func TestTailTimestampRotation(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { rotateCheckInterval = interval }(rotateCheckInterval)
+	rotateCheckInterval = 10 * time.Millisecond
+
+	conf := Config{
+		Paths: []string{ts.tmpdir + "/app.log.*"},
+		Type:  RotateStyleTimestamp,
+		Options: TailOptions{
+			ReadFrom:  "start",
+			StateFile: ts.tmpdir,
+		},
+	}
+	ts.writeFile(t, ts.tmpdir+"/app.log.2026-10-14", "{\"day\":14}\n")
+	ts.writeFile(t, ts.tmpdir+"/app.log.2026-10-15", "{\"day\":15}\n")
+
+	chanArr, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chanArr) != 1 {
+		t.Fatalf("expected one channel for the rotated series, got %d", len(chanArr))
+	}
+	lines := chanArr[0]
+	expectLine(t, lines, "{\"day\":15}")
+
+	// a final write to the old file followed by the rotation to a new one
+	fh, err := os.OpenFile(ts.tmpdir+"/app.log.2026-10-15", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(fh, "{\"day\":15,\"last\":true}\n")
+	fh.Close()
+	ts.writeFile(t, ts.tmpdir+"/app.log.2026-10-16", "{\"day\":16}\n")
+
+	expectLine(t, lines, "{\"day\":15,\"last\":true}")
+	expectLine(t, lines, "{\"day\":16}")
+
+	// each file in the series gets its own statefile
+	for _, day := range []string{"15", "16"} {
+		if _, err := os.Stat(ts.tmpdir + "/app.log.2026-10-" + day + ".leash.state"); err != nil {
+			t.Errorf("expected statefile for day %s: %s", day, err)
+		}
+	}
+
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+}
+
+func TestParseRotateStyle(t *testing.T) {
+	for style, expected := range map[string]RotateStyle{
+		"":          RotateStyleSyslog,
+		"syslog":    RotateStyleSyslog,
+		"timestamp": RotateStyleTimestamp,
+	} {
+		actual, err := ParseRotateStyle(style)
+		if err != nil || actual != expected {
+			t.Errorf("ParseRotateStyle(%q) = %v, %v; expected %v", style, actual, err, expected)
+		}
+	}
+	if _, err := ParseRotateStyle("daily"); err == nil {
+		t.Error("expected error from ParseRotateStyle for unknown style")
+	}
+}
+
 func TestRemoveStateFiles(t *testing.T) {
 	files := []string{
 		"foo.bar",
@@ -390,6 +492,406 @@ func TestStatefilesWithDifferentPathsGetDifferentHashes(t *testing.T) {
 	}
 }
 
+func TestGetStartLocation(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "{\"a\":1}\n{\"b\":2}\n")
+	logStat := unix.Stat_t{}
+	if err := unix.Stat(logFile, &logStat); err != nil {
+		t.Fatal(err)
+	}
+	checksum, checksumBytes, err := getFingerprint(logFile, fingerprintBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	beginning := &tail.SeekInfo{}
+	end := &tail.SeekInfo{Offset: 0, Whence: 2}
+	tsts := []struct {
+		desc     string
+		state    string
+		expected *tail.SeekInfo
+	}{
+		{"no statefile", "", end},
+		{"old statefile, same inode",
+			fmt.Sprintf(`{"INode":%d,"Offset":8}`, logStat.Ino),
+			&tail.SeekInfo{Offset: 8}},
+		{"old statefile, different inode",
+			fmt.Sprintf(`{"INode":%d,"Offset":8}`, logStat.Ino+1),
+			beginning},
+		{"same fingerprint and size, different inode",
+			fmt.Sprintf(`{"INode":%d,"Offset":8,"Size":16,"Checksum":"%s","ChecksumBytes":%d}`, logStat.Ino+1, checksum, checksumBytes),
+			&tail.SeekInfo{Offset: 8}},
+		{"same fingerprint, different inode and size",
+			fmt.Sprintf(`{"INode":%d,"Offset":8,"Size":8,"Checksum":"%s","ChecksumBytes":8}`, logStat.Ino+1, getTestFingerprint(t, logFile, 8)),
+			beginning},
+		{"different fingerprint, same inode",
+			fmt.Sprintf(`{"INode":%d,"Offset":8,"Size":16,"Checksum":"%x","ChecksumBytes":%d}`, logStat.Ino, sha1.Sum(nil), checksumBytes),
+			beginning},
+		{"fingerprint of fewer bytes than the file now has",
+			fmt.Sprintf(`{"INode":%d,"Offset":8,"Size":8,"Checksum":"%s","ChecksumBytes":8}`, logStat.Ino, getTestFingerprint(t, logFile, 8)),
+			&tail.SeekInfo{Offset: 8}},
+		{"offset past EOF",
+			fmt.Sprintf(`{"INode":%d,"Offset":100,"Size":100,"Checksum":"%s","ChecksumBytes":%d}`, logStat.Ino, checksum, checksumBytes),
+			beginning},
+		{"file smaller than when last seen",
+			fmt.Sprintf(`{"INode":%d,"Offset":8,"Size":50,"Checksum":"%s","ChecksumBytes":%d}`, logStat.Ino, checksum, checksumBytes),
+			beginning},
+	}
+	for _, tt := range tsts {
+		os.Remove(stateFile)
+		if tt.state != "" {
+			ts.writeFile(t, stateFile, tt.state)
+		}
+		actual := getStartLocation(stateFile, logFile)
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: got %+v, expected %+v", tt.desc, actual, tt.expected)
+		}
+	}
+}
+
+func TestGetStartLocationSameHeader(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	logFile := ts.tmpdir + "/app.csv"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "time,msg\n1,a\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start"},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	expectLine(t, lines, "time,msg")
+	expectLine(t, lines, "1,a")
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+
+	// the new file starts with the same bytes as all of the old one, and is
+	// longer, but it's a different file
+	if err := os.Rename(logFile, logFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, logFile, "time,msg\n1,a\n2,b\n")
+	if loc := getStartLocation(stateFile, logFile); !reflect.DeepEqual(loc, &tail.SeekInfo{}) {
+		t.Errorf("expected to start at the beginning, got %+v", loc)
+	}
+}
+
+func TestBytesBehind(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { lagCheckInterval = interval }(lagCheckInterval)
+	lagCheckInterval = 10 * time.Millisecond
+
+	logFile := ts.tmpdir + "/app.log"
+	ts.writeFile(t, logFile, "{\"a\":1}\n{\"b\":2}\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start"},
+	}
+	tailer, err := getTailer(conf, logFile, ts.tmpdir+"/app.leash.state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, ts.tmpdir+"/app.leash.state")
+	behindBy := func(expected int64) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if behind, ok := BytesBehind()[logFile]; ok && behind == expected {
+				return
+			}
+			time.Sleep(lagCheckInterval)
+		}
+		t.Errorf("expected to be %d bytes behind, got %v", expected, BytesBehind())
+	}
+	behindBy(16)
+	expectLine(t, lines, "{\"a\":1}")
+	behindBy(8)
+	expectLine(t, lines, "{\"b\":2}")
+	behindBy(0)
+
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := BytesBehind()[logFile]; !ok {
+			return
+		}
+		time.Sleep(lagCheckInterval)
+	}
+	t.Error("expected files that are no longer tailed to be left out")
+}
+
+// isOpen returns whether this process has file open
+func isOpen(t *testing.T, file string) bool {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("unable to list open files:", err)
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink("/proc/self/fd/" + fd.Name())
+		if err == nil && strings.TrimSuffix(target, " (deleted)") == file {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIdleTimeout(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { idleCheckInterval = interval }(idleCheckInterval)
+	idleCheckInterval = 10 * time.Millisecond
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "one\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start", IdleTimeout: 1},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	expectLine(t, lines, "one")
+	closedBy := func(deadline time.Duration) {
+		end := time.Now().Add(deadline)
+		for time.Now().Before(end) {
+			if !isOpen(t, logFile) {
+				return
+			}
+			time.Sleep(idleCheckInterval)
+		}
+		t.Fatal("expected the file to be closed")
+	}
+	closedBy(3 * time.Second)
+	state := State{}
+	content, _ := os.ReadFile(stateFile)
+	if err := json.Unmarshal(content, &state); err != nil || state.Offset != 4 {
+		t.Errorf("expected the position to be saved when the file was closed, got %s", content)
+	}
+
+	// writing to the file reopens it where it left off
+	fh, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.WriteString("two\n")
+	fh.Close()
+	if line := expectLine(t, lines, "two"); line.Offset != 8 {
+		t.Errorf("got offset %d, expected 8", line.Offset)
+	}
+
+	// a deleted file is let go of well before the idle timeout, and a new
+	// file by the same name is read from the start
+	os.Remove(logFile)
+	closedBy(500 * time.Millisecond)
+	ts.writeFile(t, logFile, "three\n")
+	if line := expectLine(t, lines, "three"); line.Offset != 6 {
+		t.Errorf("got offset %d, expected 6", line.Offset)
+	}
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+}
+
+func TestRotatedOffsets(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+	defer func(interval time.Duration) { idleCheckInterval = interval }(idleCheckInterval)
+	idleCheckInterval = 10 * time.Millisecond
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "one\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start"},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	if line := expectLine(t, lines, "one"); line.Offset != 4 {
+		t.Errorf("got offset %d, expected 4", line.Offset)
+	}
+
+	// the new file is already past the old one's offset when it's read, and
+	// its offsets start over
+	if err := os.Rename(logFile, logFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	ts.writeFile(t, logFile, "a longer first line\ntwo\n")
+	if line := expectLine(t, lines, "a longer first line"); line.Offset != 20 {
+		t.Errorf("got offset %d, expected 20", line.Offset)
+	}
+	if line := expectLine(t, lines, "two"); line.Offset != 24 {
+		t.Errorf("got offset %d, expected 24", line.Offset)
+	}
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+}
+
+func TestFollowLongLines(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "short\n"+strings.Repeat("x", 20)+"\nsixsix\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start", MaxLineBytes: 5},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only enough of a line to tell it's too long is passed along, for
+	// readLines to truncate or drop
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	expectLine(t, lines, "short")
+	if line := expectLine(t, lines, "xxxxxx"); line.Offset != 27 {
+		t.Errorf("got offset %d, expected 27", line.Offset)
+	}
+	// a line read along with a long one, and as long as what's kept of it,
+	// is a line of its own
+	if line := expectLine(t, lines, "sixsix"); line.Offset != 34 {
+		t.Errorf("got offset %d, expected 34", line.Offset)
+	}
+
+	fh, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.WriteString("after\n")
+	fh.Close()
+	if line := expectLine(t, lines, "after"); line.Offset != 40 {
+		t.Errorf("got offset %d, expected 40", line.Offset)
+	}
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+}
+
+func TestUpdateStateFile(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "{\"a\":1}\n{\"b\":2}\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start"},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	expectLine(t, lines, "{\"a\":1}")
+	expectLine(t, lines, "{\"b\":2}")
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+
+	content, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := State{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Offset != 16 || state.Size != 16 || state.ChecksumBytes != 16 ||
+		state.Checksum != getTestFingerprint(t, logFile, 16) {
+		t.Errorf("unexpected state saved: %+v", state)
+	}
+	// and picking up where we left off
+	if loc := getStartLocation(stateFile, logFile); loc.Offset != 16 {
+		t.Errorf("expected to resume at offset 16, got %+v", loc)
+	}
+}
+
+func TestCommitOffset(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	logFile := ts.tmpdir + "/app.log"
+	stateFile := ts.tmpdir + "/app.leash.state"
+	ts.writeFile(t, logFile, "{\"a\":1}\n{\"b\":2}\n")
+	conf := Config{
+		Options: TailOptions{ReadFrom: "start", CommitOnAck: true},
+	}
+	tailer, err := getTailer(conf, logFile, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := tailSingleFile(ts.ctx, conf, tailer, logFile, stateFile)
+	first := expectLine(t, lines, "{\"a\":1}")
+	second := expectLine(t, lines, "{\"b\":2}")
+	if first.Source != logFile || first.Offset != 8 || second.Offset != 16 {
+		t.Errorf("unexpected line positions: %+v, %+v", first, second)
+	}
+	ts.cancel()
+	checkLinesChanClosed(t, lines)
+
+	// nothing gets saved until the lines are committed
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected no statefile before committing, got %v", err)
+	}
+	if err := CommitOffset(logFile, first.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if loc := getStartLocation(stateFile, logFile); loc.Offset != 8 {
+		t.Errorf("expected to resume at offset 8, got %+v", loc)
+	}
+	// offsets past the end of the file are capped at its size
+	if err := CommitOffset(logFile, 17); err != nil {
+		t.Fatal(err)
+	}
+	if loc := getStartLocation(stateFile, logFile); loc.Offset != 16 {
+		t.Errorf("expected to resume at offset 16, got %+v", loc)
+	}
+	// files that aren't tailed with --tail.commit_on_ack are left alone
+	if err := CommitOffset(ts.tmpdir+"/other.log", 8); err != nil {
+		t.Error(err)
+	}
+
+	// the closed file's statefile is kept until its last line is committed
+	if ForgetClosedFile(logFile, first.Offset) {
+		t.Error("expected the statefile to be kept until the last line is committed")
+	}
+	if !ForgetClosedFile(logFile, second.Offset) {
+		t.Error("expected the statefile to be forgotten once the last line is committed")
+	}
+	if err := CommitOffset(logFile, first.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if loc := getStartLocation(stateFile, logFile); loc.Offset != 16 {
+		t.Errorf("expected a forgotten statefile to be left alone, got %+v", loc)
+	}
+}
+
+func getTestFingerprint(t *testing.T, file string, n int64) string {
+	checksum, _, err := getFingerprint(file, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checksum
+}
+
 // boilerplate to spin up a httptest server, create tmpdir, etc.
 // to create an environment in which to run these tests
 type testSetup struct {
@@ -421,11 +923,11 @@ func (ts *testSetup) stop() {
 	os.RemoveAll(ts.tmpdir)
 }
 
-func checkLinesChan(t *testing.T, actual chan string, expected []string) {
+func checkLinesChan(t *testing.T, actual chan event.Line, expected []string) {
 	idx := 0
 	for line := range actual {
-		if idx < len(expected) && expected[idx] != line {
-			t.Errorf("got line '%s', expected line '%s'", line, expected[idx])
+		if idx < len(expected) && expected[idx] != line.Text {
+			t.Errorf("got line '%s', expected line '%s'", line.Text, expected[idx])
 		}
 		idx++
 	}
@@ -434,7 +936,20 @@ func checkLinesChan(t *testing.T, actual chan string, expected []string) {
 	}
 }
 
-func checkLinesChanClosed(t *testing.T, actual chan string) {
+func expectLine(t *testing.T, actual chan event.Line, expected string) event.Line {
+	select {
+	case line := <-actual:
+		if line.Text != expected {
+			t.Errorf("got line '%s', expected line '%s'", line.Text, expected)
+		}
+		return line
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed out waiting for line '%s'", expected)
+	}
+	return event.Line{}
+}
+
+func checkLinesChanClosed(t *testing.T, actual chan event.Line) {
 	// this will block if actual never gets closed
 	for {
 		select {
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+	"github.com/honeycombio/honeytail/tail"
+)
+
+// windowTimeFormats are the formats --backfill_start and --backfill_end can be
+// given in. Times without a time zone are in the --timezone.
+var windowTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// maxProbeLines is how many lines the search for --backfill_start reads at
+// each step looking for one with a timestamp before giving up on that step
+const maxProbeLines = 1000
+
+// timeWindow is the span of time given by --backfill_start and
+// --backfill_end. A zero start or end leaves the window open at that side.
+type timeWindow struct {
+	start time.Time
+	end   time.Time
+	// startedAt is when honeytail started. Parsers use the current time for
+	// events they can't find a timestamp for, so timestamps after this one
+	// can't be told apart from those.
+	startedAt time.Time
+}
+
+// newTimeWindow returns the window set by --backfill_start and
+// --backfill_end, or nil if neither is set
+func newTimeWindow(options GlobalOptions) (*timeWindow, error) {
+	if options.BackfillStart == "" && options.BackfillEnd == "" {
+		return nil, nil
+	}
+	window := &timeWindow{startedAt: time.Now()}
+	var err error
+	if window.start, err = parseWindowTime("--backfill_start", options.BackfillStart); err != nil {
+		return nil, err
+	}
+	if window.end, err = parseWindowTime("--backfill_end", options.BackfillEnd); err != nil {
+		return nil, err
+	}
+	switch {
+	case !window.start.IsZero() && !window.end.IsZero() && !window.start.Before(window.end):
+		return nil, fmt.Errorf("--backfill_start %s must be before --backfill_end %s", options.BackfillStart, options.BackfillEnd)
+	case window.start.After(window.startedAt):
+		return nil, fmt.Errorf("--backfill_start %s is in the future", options.BackfillStart)
+	case window.end.After(window.startedAt):
+		return nil, fmt.Errorf("--backfill_end %s is in the future", options.BackfillEnd)
+	}
+	return window, nil
+}
+
+// parseWindowTime parses the value of flag, which is empty if it wasn't set
+func parseWindowTime(flag string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, format := range windowTimeFormats {
+		if ts, err := httime.Parse(format, value); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse %s %s. Use a time like 2006-01-02T15:04:05Z", flag, value)
+}
+
+// known returns whether ts is a timestamp found in a line, rather than one
+// made up by a parser that couldn't find one
+func (w *timeWindow) known(ts time.Time) bool {
+	return !ts.IsZero() && ts.Before(w.startedAt)
+}
+
+// filterEvents drops events with timestamps outside the window. The first
+// time an event is at or after the end of the window, the file it came from
+// stops being read and pastEnd is closed. Events without a known timestamp
+// are passed along.
+func (w *timeWindow) filterEvents(events chan event.Event, pastEnd chan struct{}) chan event.Event {
+	filtered := make(chan event.Event)
+	go func() {
+		defer close(filtered)
+		for ev := range events {
+			if w.known(ev.Timestamp) {
+				if ev.Timestamp.Before(w.start) {
+					continue
+				}
+				if !w.end.IsZero() && !ev.Timestamp.Before(w.end) {
+					if !isClosed(pastEnd) {
+						logrus.WithFields(logrus.Fields{
+							"file":      ev.Source,
+							"timestamp": ev.Timestamp,
+						}).Info("Reached --backfill_end, done reading file")
+						tail.StopFile(ev.Source)
+						close(pastEnd)
+					}
+					continue
+				}
+			}
+			filtered <- ev
+		}
+	}()
+	return filtered
+}
+
+// isClosed returns whether ch has been closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopLines passes along lines until pastEnd is closed, then closes the
+// channel it returns so the parser can finish up. Any lines still to come
+// are thrown away, and the files they're from are stopped too, which moves
+// a --tail.ordered series along to its end.
+func stopLines(lines chan event.Line, pastEnd chan struct{}) chan event.Line {
+	stopped := make(chan event.Line)
+	go func() {
+	SendLines:
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					close(stopped)
+					return
+				}
+				select {
+				case stopped <- line:
+				case <-pastEnd:
+					tail.StopFile(line.Source)
+					break SendLines
+				}
+			case <-pastEnd:
+				break SendLines
+			}
+		}
+		close(stopped)
+		for line := range lines {
+			tail.StopFile(line.Source)
+		}
+	}()
+	return stopped
+}
+
+// canSearchFiles returns whether each line of a file can be parsed on its own
+// to find its timestamp, which the search for --backfill_start relies on
+func canSearchFiles(options GlobalOptions) bool {
+	switch {
+	case options.Reqs.ParserName == "mysql" || options.Reqs.ParserName == "postgresql":
+		return false
+	case options.Multiline.Enabled():
+		return false
+	case options.Tail.Format != "" && options.Tail.Format != "plain":
+		return false
+	}
+	return true
+}
+
+// findStartOffsets searches each of the files matching --file for the first
+// line at or after the start of the window, to start reading from there.
+// Files that can't be searched, like compressed ones, are left out and read
+// from wherever they would have been.
+func findStartOffsets(options GlobalOptions, window *timeWindow) (map[string]int64, error) {
+	lineTime, err := newLineTimer(options, window)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[string]int64)
+	for _, pattern := range options.Reqs.LogFiles {
+		if pattern == "-" {
+			continue
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if tail.IsCompressed(file) {
+				// compressed files can't be seeked, so have to be read
+				// from the start
+				continue
+			}
+			offset, err := findStartOffset(file, window.start, lineTime)
+			if err != nil {
+				logrus.WithError(err).WithField("file", file).
+					Warn("unable to search file for --backfill_start, it will be read from the start")
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"file":   file,
+				"offset": offset,
+			}).Info("Found the first line at or after --backfill_start")
+			offsets[file] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// newLineTimer returns a function that parses a single line with the
+// configured parser and returns its timestamp, if the line has one
+func newLineTimer(options GlobalOptions, window *timeWindow) (func(string) (time.Time, bool), error) {
+	r := parsers.Lookup(options.Reqs.ParserName)
+	if r == nil {
+		return nil, fmt.Errorf("parser %s not found", options.Reqs.ParserName)
+	}
+	var prefixRegex *parsers.ExtRegexp
+	if options.PrefixRegex != "" {
+		prefixRegex = &parsers.ExtRegexp{Regexp: regexp.MustCompile(options.PrefixRegex)}
+	}
+	if r.HasLineParser() {
+		lineParser, lineTimer, err := r.NewLineParser(options.Parsers[r.Name], parsers.Settings{
+			NoTypeInference: options.NoTypeInference,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if lineTimer != nil {
+			return func(text string) (time.Time, bool) {
+				text = strings.TrimSpace(text)
+				if prefixRegex != nil {
+					prefix, _ := prefixRegex.FindStringSubmatchMap(text)
+					text = strings.TrimPrefix(text, prefix)
+				}
+				parsed, err := lineParser.ParseLine(text)
+				if err != nil {
+					return time.Time{}, false
+				}
+				ts, ok := lineTimer(parsed)
+				return ts, ok && window.known(ts)
+			}, nil
+		}
+	}
+
+	// the other parsers only make events with ProcessLines, which is given
+	// one line at a time to parse with a single goroutine
+	options.NumSenders = 1
+	parser, parserOpts := getParserAndOptions(options, nil)
+	if err := parser.Init(parserOpts); err != nil {
+		return nil, err
+	}
+	return func(text string) (time.Time, bool) {
+		lines := make(chan event.Line, 1)
+		events := make(chan event.Event, 1)
+		lines <- event.Line{Text: text}
+		close(lines)
+		parser.ProcessLines(lines, events, prefixRegex)
+		close(events)
+		ev, ok := <-events
+		if !ok || !window.known(ev.Timestamp) {
+			return time.Time{}, false
+		}
+		return ev.Timestamp, true
+	}, nil
+}
+
+// findStartOffset binary searches file for the offset of the first line with
+// a timestamp at or after start, assuming the lines are in time order. Lines
+// without a timestamp are skipped over. When the search can't tell where
+// start is, it errs towards an earlier line.
+func findStartOffset(file string, start time.Time, lineTime func(string) (time.Time, bool)) (int64, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	info, err := fh.Stat()
+	if err != nil {
+		return 0, err
+	}
+	// every line starting before lo is before start, and the first line at or
+	// after start begins at or before hi
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		lineStart, lineEnd, ts, found, err := findTimedLine(fh, mid, hi, lineTime)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case !found:
+			hi = mid
+		case ts.Before(start):
+			lo = lineEnd
+		default:
+			hi = lineStart
+		}
+	}
+	if lo >= info.Size() {
+		// every line is before start
+		return info.Size(), nil
+	}
+	return findLineStart(fh, lo)
+}
+
+// findTimedLine reads forward from the first line that begins at or after
+// from, returning where the first line with a timestamp begins and ends, and
+// its timestamp. Lines beginning at or after limit aren't considered.
+func findTimedLine(fh *os.File, from int64, limit int64, lineTime func(string) (time.Time, bool)) (int64, int64, time.Time, bool, error) {
+	pos := from
+	if from > 0 {
+		// from is a line's start if the line before it ends right before it
+		pos = from - 1
+	}
+	if _, err := fh.Seek(pos, io.SeekStart); err != nil {
+		return 0, 0, time.Time{}, false, err
+	}
+	reader := bufio.NewReader(fh)
+	if from > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return 0, 0, time.Time{}, false, nil
+		} else if err != nil {
+			return 0, 0, time.Time{}, false, err
+		}
+		pos += int64(len(skipped))
+	}
+	for i := 0; i < maxProbeLines && pos < limit; i++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return 0, 0, time.Time{}, false, err
+		}
+		if text == "" {
+			break
+		}
+		end := pos + int64(len(text))
+		if ts, ok := lineTime(strings.TrimSuffix(text, "\n")); ok {
+			return pos, end, ts, true, nil
+		}
+		pos = end
+	}
+	return 0, 0, time.Time{}, false, nil
+}
+
+// findLineStart returns where the line containing offset begins
+func findLineStart(fh *os.File, offset int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for offset > 0 {
+		n := int64(len(buf))
+		if n > offset {
+			n = offset
+		}
+		if _, err := fh.ReadAt(buf[:n], offset-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return offset - n + int64(i) + 1, nil
+		}
+		offset -= n
+	}
+	return 0, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// transformStep is a type of step in the transforms of the YAML config, one of
+// the ways the events of a pipeline can be munged
+type transformStep struct {
+	// keys are the YAML keys of the options a step of this type can set
+	keys []string
+	// parserOptions is whether the step can set the options of parsers too
+	parserOptions bool
+	// build returns the transform the options ask for, or nil if they don't
+	// ask for anything
+	build func(options GlobalOptions, stats *responseStats) func(ev *event.Event)
+}
+
+// transformSteps are the types of step, by the name used for them in the
+// YAML config
+var transformSteps = map[string]transformStep{
+	"subparse":      {keys: []string{"subparse", "subparse_timestamp"}, parserOptions: true, build: subparseTransform},
+	"field_type":    {keys: []string{"field_type"}, build: fieldTypeTransform},
+	"filter":        {keys: []string{"filter", "invert_filter"}, build: filterTransform},
+	"request_shape": {keys: []string{"request_shape", "shape_prefix", "request_pattern", "request_parse_query", "request_query_keys"}, build: requestShapeTransform},
+	"da_map_file":   {keys: []string{"da_map_file"}, build: augmentTransform},
+	"drop_field":    {keys: []string{"drop_field"}, build: dropTransform},
+	"redact":        {keys: []string{"redact", "redact_field", "redact_hash_key"}, build: redactTransform},
+	"scrub_field":   {keys: []string{"scrub_field"}, build: scrubTransform},
+	"add_field":     {keys: []string{"add_field"}, build: addTransform},
+	// sampling also decides whether lines are sampled while tailing, so its
+	// options can only be set for the whole pipeline
+	"sample":       {build: sampleTransform},
+	"rebase_time":  {keys: []string{"rebase_time"}, build: rebaseTransform},
+	"json_field":   {keys: []string{"json_field"}, build: jsonTransform},
+	"rename_field": {keys: []string{"rename_field"}, build: renameTransform},
+}
+
+// defaultTransforms is the order the steps run in when the YAML config
+// doesn't list them, which is what the flags do
+var defaultTransforms = []string{
+	// parse fields with other parsers first, so the fields found get the rest
+	// of the munging
+	"subparse",
+	// then give the fields the types they're meant to have
+	"field_type",
+	// drop the events --filter doesn't want before doing any more work on them
+	"filter",
+	"request_shape",
+	"da_map_file",
+	"drop_field",
+	"redact",
+	"scrub_field",
+	"add_field",
+	"sample",
+	"rebase_time",
+	"json_field",
+	"rename_field",
+}
+
+// configuredStep is a step to run, with the options it runs with
+type configuredStep struct {
+	name    string
+	options GlobalOptions
+	// listed is whether the step is listed in the YAML config
+	listed bool
+}
+
+// getTransformSteps returns the steps to run for options. The ones listed in
+// the transforms of the YAML config run in the order they're written, each
+// with the options set in it on top of the pipeline's. Sampling is done last
+// if it isn't listed, as every event needs a sample rate. Without a list, all
+// the steps run in the default order.
+func getTransformSteps(options GlobalOptions) ([]configuredStep, error) {
+	if len(options.Transforms) == 0 {
+		steps := make([]configuredStep, 0, len(defaultTransforms))
+		for _, name := range defaultTransforms {
+			steps = append(steps, configuredStep{name: name, options: options})
+		}
+		return steps, nil
+	}
+	base := options
+	base.Transforms = nil
+	steps := make([]configuredStep, 0, len(options.Transforms)+1)
+	sampled := false
+	for i, node := range options.Transforms {
+		var header struct {
+			Type string `yaml:"type"`
+		}
+		if err := node.Decode(&header); err != nil {
+			return nil, fmt.Errorf("unable to read transform %d: %s", i+1, err)
+		}
+		step, ok := transformSteps[header.Type]
+		if !ok {
+			return nil, fmt.Errorf("transform %d has unknown type %q, should be one of %s",
+				i+1, header.Type, strings.Join(defaultTransforms, ", "))
+		}
+		if header.Type == "sample" {
+			if sampled {
+				return nil, fmt.Errorf("transform %d samples the events again, there can only be one sample step", i+1)
+			}
+			sampled = true
+		}
+		allowed := map[string]bool{"type": true}
+		for _, key := range step.keys {
+			allowed[key] = true
+		}
+		if step.parserOptions {
+			for _, r := range parsers.Registered() {
+				allowed[r.Name] = true
+			}
+		}
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if key := node.Content[j].Value; !allowed[key] {
+				return nil, fmt.Errorf("transform %d is a %s step, which can't set %s", i+1, header.Type, key)
+			}
+		}
+		stepOptions := base
+		if err := node.Decode(&stepOptions); err != nil {
+			return nil, fmt.Errorf("unable to read transform %d: %s", i+1, err)
+		}
+		steps = append(steps, configuredStep{name: header.Type, options: stepOptions, listed: true})
+	}
+	if !sampled {
+		steps = append(steps, configuredStep{name: "sample", options: base})
+	}
+	return steps, nil
+}
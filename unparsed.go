@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// unparsedDatasetPrefix starts an --unparsed_output that names a dataset
+// rather than a file
+const unparsedDatasetPrefix = "dataset:"
+
+// unparsedOutput counts the lines of a pipeline that fail to parse and, with
+// --unparsed_output, writes them to a file as newline delimited JSON or sends
+// them as events to a dataset of their own
+type unparsedOutput struct {
+	parser   string
+	pipeline string
+	stats    *responseStats
+	// transforms keep the sensitive parts of the lines from being written or
+	// sent, as they are from the pipeline's events
+	transforms []func(ev *event.Event)
+
+	// file is set when writing to a file
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+
+	// dataset and events are set when sending to a dataset, through the same
+	// sink as the pipeline's events
+	dataset     string
+	events      chan event.Event
+	doneSending chan struct{}
+}
+
+// newUnparsedOutput opens the --unparsed_output of a pipeline, whose events
+// go to s
+func newUnparsedOutput(options GlobalOptions, s *sink) (*unparsedOutput, error) {
+	u := &unparsedOutput{
+		parser:   options.Reqs.ParserName,
+		pipeline: options.Name,
+		stats:    s.stats,
+	}
+	if options.UnparsedOutput != "" {
+		transforms, err := getUnparsedTransforms(options, s.stats)
+		if err != nil {
+			return nil, err
+		}
+		u.transforms = transforms
+	}
+	switch {
+	case options.UnparsedOutput == "":
+	case strings.HasPrefix(options.UnparsedOutput, unparsedDatasetPrefix):
+		u.dataset = strings.TrimPrefix(options.UnparsedOutput, unparsedDatasetPrefix)
+		u.events = make(chan event.Event, options.NumSenders)
+		u.doneSending = make(chan struct{})
+		go func() {
+			s.SendEvents(u.events)
+			close(u.doneSending)
+		}()
+	default:
+		f, err := os.OpenFile(options.UnparsedOutput, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		u.file = f
+		u.encoder = json.NewEncoder(f)
+	}
+	return u, nil
+}
+
+// unparsedSteps are the transform steps the lines that fail to parse go
+// through, the ones that drop, redact or hash what shouldn't leave the host
+var unparsedSteps = map[string]bool{"drop_field": true, "redact": true, "scrub_field": true}
+
+// getUnparsedTransforms returns the transforms for the lines that fail to
+// parse, set up as they are for the pipeline's events. With --redact_field,
+// the line and the error, which may quote it, are redacted too, as the fields
+// can't be told apart in them.
+func getUnparsedTransforms(options GlobalOptions, stats *responseStats) ([]func(ev *event.Event), error) {
+	steps, err := getTransformSteps(options)
+	if err != nil {
+		return nil, err
+	}
+	var transforms []func(ev *event.Event)
+	for _, step := range steps {
+		if !unparsedSteps[step.name] {
+			continue
+		}
+		if step.name == "redact" && len(step.options.RedactFields) != 0 {
+			step.options.RedactFields = append([]string{"line", "error"}, step.options.RedactFields...)
+		}
+		if transform := transformSteps[step.name].build(step.options, stats); transform != nil {
+			transforms = append(transforms, transform)
+		}
+	}
+	return transforms, nil
+}
+
+// report counts a line that failed to parse, and writes or sends it along
+// with where it came from and why it didn't parse
+func (u *unparsedOutput) report(line event.Line, err error) {
+	u.stats.countUnparsed(u.parser)
+	if u.file == nil && u.events == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"line":   line.Text,
+		"file":   line.Source,
+		"offset": line.Offset,
+		"parser": u.parser,
+		"error":  fmt.Sprint(err),
+	}
+	if u.pipeline != "" {
+		data["pipeline"] = u.pipeline
+	}
+	for k, v := range line.Fields {
+		if _, ok := data[k]; !ok {
+			data[k] = v
+		}
+	}
+	ev := event.Event{Data: data}
+	for _, transform := range u.transforms {
+		transform(&ev)
+	}
+	data = ev.Data
+	if u.events != nil {
+		// no Source, so the event isn't mistaken for one parsed from the file
+		u.events <- event.Event{
+			Timestamp:  time.Now(),
+			SampleRate: 1,
+			Data:       data,
+			Dataset:    u.dataset,
+		}
+		return
+	}
+	data["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if err := u.encoder.Encode(data); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"file":  u.file.Name(),
+			"error": err,
+		}).Warn("Unable to write unparsed line to --unparsed_output")
+	}
+}
+
+// close finishes writing or sending, once the pipeline's parsers are done
+func (u *unparsedOutput) close() {
+	if u.events != nil {
+		close(u.events)
+		<-u.doneSending
+	}
+	if u.file != nil {
+		if err := u.file.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"file":  u.file.Name(),
+				"error": err,
+			}).Warn("Unable to close --unparsed_output")
+		}
+	}
+}